@@ -1,17 +1,38 @@
 package cli
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"log"
 	"os"
-	"os/exec"
+	"os/signal"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/davinche/gmux/command"
 	"github.com/davinche/gmux/config"
 	"github.com/urfave/cli"
 )
 
-func init() {
-	startServer()
+// Before makes sure the tmux server is running before any command executes.
+// log-pipe is run by tmux itself, possibly for a server other than the
+// default one, and doesn't need it.
+func Before(c *cli.Context) error {
+	if c.Args().First() == "log-pipe" {
+		return nil
+	}
+	ctx, cancel := newContext(c)
+	err := startServer(ctx, c, tmuxFlags(c))
+	cancel()
+	if err != nil {
+		// cli would print the whole help along with a returned error
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return nil
 }
 
 // New handles the creation of a new gmux config
@@ -52,46 +73,441 @@ func Delete(c *cli.Context) error {
 	return config.Delete(configName)
 }
 
-// Start handles running a gmux config
+// Start handles running a gmux config, or several configs at once
 func Start(c *cli.Context) error {
+	names := []string(c.Args())
+	if len(names) == 0 {
+		return ShowHelp(c)
+	}
+	return start(c, names)
+}
+
+// start runs the given configs
+func start(c *cli.Context, names []string) error {
+	ctx, cancel := newContext(c)
+	defer cancel()
+
+	// An explicit session name lets the same config run more than once
+	sessionName := c.String("name")
+	if !config.ValidSessionName(sessionName) {
+		return cli.NewExitError("session names can not contain any of ':', '.', ',', '}' or '#'", 1)
+	}
+	if policy := c.String("if-exists"); policy != "" && !config.ValidIfExists(policy) {
+		return cli.NewExitError(fmt.Sprintf("invalid --if-exists policy: %q", policy), 1)
+	}
+
+	if len(names) == 1 {
+		cfg, err := config.Get(names[0])
+		if err != nil || !cfg.IsGroup() {
+			return startOne(ctx, c, names[0], cfg, err)
+		}
+	}
+	if sessionName != "" {
+		return cli.NewExitError("--name can only be used when starting a single config", 1)
+	}
+	return startMany(ctx, c, names)
+}
+
+// startOne starts a single config, applying the --if-exists policy (or the
+// config's IfExists) when its session is already running. A session that was
+// not started by gmux can still be attached to by name.
+func startOne(ctx context.Context, c *cli.Context, configName string, cfg *config.Config, cfgErr error) error {
+	sessionName := c.String("name")
+	switch {
+	case sessionName != "" && cfg != nil:
+		cfg.Name = sessionName
+	case cfg != nil:
+		sessionName = cfg.Name
+	case sessionName == "":
+		sessionName = configName
+	}
+
+	t := tmuxFlags(c)
+	if cfg != nil {
+		t = cfg.Tmux(t)
+	}
+	if hasSession(ctx, c, t, sessionName) {
+		switch ifExists(c, cfg) {
+		case config.IfExistsFail:
+			return cli.NewExitError(fmt.Sprintf("session %q already exists", sessionName), 1)
+		case config.IfExistsRecreate:
+			if cfgErr != nil {
+				return cli.NewExitError(cfgErr, 1)
+			}
+			removeBindings(ctx, c, t, sessionName)
+			if err := killSession(ctx, c, t, sessionName); err != nil {
+				return cli.NewExitError(fmt.Sprintf("could not kill session %q: %s", sessionName, err), 1)
+			}
+			if err := waitSessionGone(ctx, c, t, sessionName); err != nil {
+				return cli.NewExitError(err, 1)
+			}
+		case config.IfExistsReconcile:
+			if cfgErr != nil {
+				return cli.NewExitError(cfgErr, 1)
+			}
+			if err := reconcile(ctx, c, cfg); err != nil {
+				return err
+			}
+			return attach(ctx, c, t, sessionName)
+		default:
+			return attach(ctx, c, t, sessionName)
+		}
+	}
+
+	if cfgErr != nil {
+		return cli.NewExitError(cfgErr, 1)
+	}
+	return runConfig(ctx, cfg, execOptions(ctx, c))
+}
+
+// ifExists returns the policy for a session that already exists: the
+// --if-exists flag, else the config's IfExists, else attach
+func ifExists(c *cli.Context, cfg *config.Config) string {
+	if policy := c.String("if-exists"); policy != "" {
+		return policy
+	}
+	if cfg != nil && cfg.IfExists != "" {
+		return cfg.IfExists
+	}
+	return config.IfExistsAttach
+}
+
+// runConfig executes a single config
+func runConfig(ctx context.Context, cfg *config.Config, opts config.ExecOptions) error {
+	if err := cfg.Exec(ctx, opts); err != nil {
+		if ctx.Err() == context.Canceled {
+			return cli.NewExitError("interrupted: session startup was cancelled", 130)
+		}
+		return cli.NewExitError(err, 1)
+	}
+	return nil
+}
+
+// startMany starts every given config (expanding groups) in a detached
+// session, reports how each one went, and then attaches to the primary one
+func startMany(ctx context.Context, c *cli.Context, names []string) error {
+	configs, primary, err := config.Expand(names, c.String("primary"))
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	opts := execOptions(ctx, c)
+	opts.Detached = true
+	failed := 0
+	var primaryTmux command.Tmux
+	for _, cfg := range configs {
+		t := cfg.Tmux(opts.Tmux)
+		if cfg.Name == primary {
+			primaryTmux = t
+		}
+		if hasSession(ctx, c, t, cfg.Name) {
+			switch ifExists(c, cfg) {
+			case config.IfExistsFail:
+				fmt.Printf("%s: failed: session already exists\n", cfg.Name)
+				failed++
+				continue
+			case config.IfExistsRecreate:
+				removeBindings(ctx, c, t, cfg.Name)
+				if err := killSession(ctx, c, t, cfg.Name); err != nil {
+					fmt.Printf("%s: failed: could not kill session: %s\n", cfg.Name, err)
+					failed++
+					continue
+				}
+				if err := waitSessionGone(ctx, c, t, cfg.Name); err != nil {
+					fmt.Printf("%s: failed: %s\n", cfg.Name, err)
+					failed++
+					continue
+				}
+			case config.IfExistsReconcile:
+				if err := reconcile(ctx, c, cfg); err != nil {
+					if ctx.Err() == context.Canceled {
+						return err
+					}
+					fmt.Printf("%s: failed: %s\n", cfg.Name, err)
+					failed++
+					continue
+				}
+				fmt.Printf("%s: reconciled\n", cfg.Name)
+				continue
+			default:
+				fmt.Printf("%s: already running\n", cfg.Name)
+				continue
+			}
+		}
+		if err := runConfig(ctx, cfg, opts); err != nil {
+			if ctx.Err() == context.Canceled {
+				return err
+			}
+			fmt.Printf("%s: failed: %s\n", cfg.Name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: started\n", cfg.Name)
+	}
+
+	if failed > 0 {
+		return cli.NewExitError(fmt.Sprintf("%d of %d sessions failed to start", failed, len(configs)), 1)
+	}
+	return attach(ctx, c, primaryTmux, primary)
+}
+
+// Apply makes a running session match its config, creating the session if it
+// is not running yet
+func Apply(c *cli.Context) error {
 	configName := c.Args().First()
 	if configName == "" {
 		return ShowHelp(c)
 	}
+	cfg, err := config.Get(configName)
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+	if name := c.String("name"); name != "" {
+		cfg.Name = name
+	}
+
+	ctx, cancel := newContext(c)
+	defer cancel()
+	if !hasSession(ctx, c, cfg.Tmux(tmuxFlags(c)), cfg.Name) {
+		opts := execOptions(ctx, c)
+		opts.Detached = true
+		if err := runConfig(ctx, cfg, opts); err != nil {
+			return err
+		}
+		fmt.Printf("%s: started\n", cfg.Name)
+		return nil
+	}
+	return reconcile(ctx, c, cfg)
+}
 
-	if hasSession(configName) {
-		if err := config.AttachToSession(configName); err != nil {
-			return cli.NewExitError(fmt.Sprintf("could not attach to session %q", configName), 1)
+// reconcile adds whatever is missing from a running session and prints the
+// changes made. Extra windows and panes are removed with --prune.
+func reconcile(ctx context.Context, c *cli.Context, cfg *config.Config) error {
+	changes, err := cfg.Reconcile(ctx, execOptions(ctx, c), c.Bool("prune"))
+	for _, change := range changes {
+		fmt.Printf("%s: %s\n", cfg.Name, change)
+	}
+	if err != nil {
+		if ctx.Err() == context.Canceled {
+			return cli.NewExitError("interrupted: reconciling was cancelled", 130)
 		}
+		return cli.NewExitError(fmt.Sprintf("%s (the session may have been changed in part)", err), 1)
 	}
+	return nil
+}
 
-	if err := config.GetAndRun(configName, c.GlobalBool("debug")); err != nil {
+// Diff shows how a running session differs from its config
+func Diff(c *cli.Context) error {
+	configName := c.Args().First()
+	if configName == "" {
+		return ShowHelp(c)
+	}
+	cfg, err := config.Get(configName)
+	if err != nil {
 		return cli.NewExitError(err, 1)
 	}
+	if name := c.String("name"); name != "" {
+		cfg.Name = name
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+	diff, err := cfg.Diff(ctx, execOptions(ctx, c))
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	if c.Bool("json") {
+		data, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	diff.Print(os.Stdout)
 	return nil
 }
 
+// Logs prints the log of a pane, or follows it with --follow
+func Logs(c *cli.Context) error {
+	configName, pane := c.Args().Get(0), c.Args().Get(1)
+	if configName == "" || pane == "" {
+		return ShowHelp(c)
+	}
+	cfg, err := config.Get(configName)
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+	if name := c.String("name"); name != "" {
+		cfg.Name = name
+	}
+	file, err := cfg.LogFile(pane)
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	if !c.Bool("follow") {
+		if err := config.DumpLog(os.Stdout, file); err != nil {
+			return cli.NewExitError(err, 1)
+		}
+		return nil
+	}
+	// Following only ends on interrupt
+	ctx, cancel := signalContext()
+	defer cancel()
+	if err := config.FollowLog(ctx, os.Stdout, file); err != nil {
+		return cli.NewExitError(err, 1)
+	}
+	return nil
+}
+
+// LogPipe writes the output of a logged pane, read from stdin, to its log
+// file. tmux runs it through pipe-pane.
+func LogPipe(c *cli.Context) error {
+	file := c.Args().First()
+	if file == "" {
+		return ShowHelp(c)
+	}
+	return config.WriteLog(os.Stdin, file, int64(c.Int("max-size")))
+}
+
+// Ps lists the running tmux sessions and the gmux configs they were started from
+func Ps(c *cli.Context) error {
+	ctx, cancel := signalContext()
+	defer cancel()
+	sessions, err := config.ListAllSessions(ctx, newChain(execOptions(ctx, c)))
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	if c.Bool("json") {
+		if sessions == nil {
+			sessions = []*config.LiveSession{}
+		}
+		data, err := json.MarshalIndent(sessions, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SESSION\tCONFIG\tWINDOWS\tCLIENTS\tUPTIME\tSOCKET")
+	for _, s := range sessions {
+		cfg, socket := s.Config, s.Socket
+		if cfg == "" {
+			cfg = "-"
+		}
+		if socket == "" {
+			socket = "-"
+		}
+		uptime := time.Since(s.Created).Round(time.Second)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", s.Name, cfg, strings.Join(s.Windows, ","), s.Clients, uptime, socket)
+	}
+	return w.Flush()
+}
+
 // Stop handles terminating a tmux connection
 func Stop(c *cli.Context) error {
 	sessionName := c.Args().First()
+	t := tmuxFlags(c)
 
+	ctx, cancel := newContext(c)
+	defer cancel()
 	if sessionName == "" {
-		cmd := exec.Command("tmux", "display-message", "-p", "#S")
-		output, err := cmd.Output()
+		output, err := tmuxChain(c, t).Output(ctx, "tmux", "display-message", "-p", "#S")
 		if err != nil {
 			return cli.NewExitError("could not determine current tmux session", 1)
 		}
-		sessionName = strings.TrimSpace(string(output))
+		sessionName = output
+	} else if config.Exists(sessionName) {
+		// Sessions of configs with their own socket live on another server
+		if cfg, err := config.Get(sessionName); err == nil {
+			t = cfg.Tmux(t)
+		}
 	}
-	cmd := exec.Command("tmux", "kill-session", "-t", sessionName)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	if c.Args().First() != "" && !hasSession(ctx, c, t, sessionName) {
+		// e.g. a --name instance of a config with its own socket
+		if s := findSession(ctx, c, sessionName); s != nil {
+			t = s.Tmux
+		}
+	}
+	removeBindings(ctx, c, t, sessionName)
+
+	if err := killSession(ctx, c, t, sessionName); err != nil {
+		return cli.NewExitError(err, 1)
+	}
+	return nil
+}
+
+// findSession looks for a session by name on every server gmux sessions may
+// run on, returning nil if there is none
+func findSession(ctx context.Context, c *cli.Context, name string) *config.LiveSession {
+	sessions, err := config.ListAllSessions(ctx, tmuxChain(c, tmuxFlags(c)))
+	if err != nil {
+		return nil
+	}
+	for _, s := range sessions {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
 }
 
 // List shows all available gmux configurations
 func List(c *cli.Context) error {
-	return config.List()
+	// Plain names, also used for shell completion
+	if c.Bool("quiet") {
+		return config.List()
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+	sessions, err := config.ListAllSessions(ctx, newChain(execOptions(ctx, c)))
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+	summaries, err := config.Summaries(sessions)
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	if c.Bool("json") {
+		if summaries == nil {
+			summaries = []*config.Summary{}
+		}
+		data, err := json.MarshalIndent(summaries, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tDESCRIPTION\tROOT\tWINDOWS\tRUNNING")
+	for _, s := range summaries {
+		description, root, windows := s.Description, s.Root, strconv.Itoa(s.Windows)
+		switch {
+		case s.Error != "":
+			description, windows = s.Error, "-"
+		case len(s.Configs) > 0:
+			description = fmt.Sprintf("group: %s", strings.Join(s.Configs, ", "))
+			if s.Description != "" {
+				description = fmt.Sprintf("%s (group: %s)", s.Description, strings.Join(s.Configs, ", "))
+			}
+			windows = "-"
+		}
+		running := "no"
+		if s.Running {
+			running = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Name, description, root, windows, running)
+	}
+	return w.Flush()
 }
 
 // ShowHelp shows the help for the given command
@@ -108,19 +524,169 @@ func BashCompleteList(c *cli.Context) {
 	config.List()
 }
 
+// ----------------------------------------------------------------------------
+// Context Helpers ------------------------------------------------------------
+// ----------------------------------------------------------------------------
+
+// signalContext returns a context that is only cancelled on interrupt, for
+// commands that don't start sessions and so aren't limited by --timeout
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// newContext returns a context that is cancelled on Ctrl-C and expires after
+// the total timeout given by the global --timeout flag
+func newContext(c *cli.Context) (context.Context, context.CancelFunc) {
+	ctx, stop := signalContext()
+	timeout := c.GlobalDuration("timeout")
+	if timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// execOptions builds the config execution options from the global flags and
+// the version of the tmux they select
+func execOptions(ctx context.Context, c *cli.Context) config.ExecOptions {
+	opts := config.ExecOptions{
+		Debug:          c.GlobalBool("debug"),
+		CommandTimeout: c.GlobalDuration("command-timeout"),
+		Tmux:           tmuxFlags(c),
+	}
+
+	// Size new sessions for the terminal they will be attached to
+	opts.Width, opts.Height = clientSize(ctx, c)
+
+	version, err := newChain(opts).TmuxVersion(ctx)
+	if err != nil {
+		// Not fatal: an unknown version skips feature checks
+		if opts.Debug {
+			log.Printf("debug: %s", err)
+		}
+	} else if opts.Debug {
+		log.Printf("debug: detected tmux %s", version)
+	}
+	opts.TmuxVersion = version
+	return opts
+}
+
+// clientSize returns the size of the terminal gmux runs in, or zero if it
+// isn't run in one. Inside tmux, that's the size of the tmux client rather
+// than of the current pane.
+func clientSize(ctx context.Context, c *cli.Context) (int, int) {
+	if os.Getenv("TMUX") != "" {
+		t := command.Tmux{Binary: os.Getenv("GMUX_TMUX")}
+		out, err := tmuxChain(c, t).Output(ctx, "tmux", "display-message", "-p", "#{client_width} #{client_height}")
+		var width, height int
+		if _, scanErr := fmt.Sscan(out, &width, &height); err == nil && scanErr == nil && width > 0 && height > 0 {
+			return width, height
+		}
+	}
+	if !isTerminal(os.Stdin) {
+		return 0, 0
+	}
+	rows, cols := terminalSize()
+	return cols, rows
+}
+
+// tmuxChain returns an empty command chain running t with the global flags'
+// debug and timeout settings
+func tmuxChain(c *cli.Context, t command.Tmux) *command.Chain {
+	return &command.Chain{Debug: c.GlobalBool("debug"), Timeout: c.GlobalDuration("command-timeout"), Tmux: t}
+}
+
+// removeBindings removes the session's key bindings before it is killed. Not
+// being able to is only reported in debug mode, as the session goes anyway.
+func removeBindings(ctx context.Context, c *cli.Context, t command.Tmux, session string) {
+	if err := config.RemoveBindings(ctx, tmuxChain(c, t), session); err != nil && c.GlobalBool("debug") {
+		log.Printf("debug: could not remove key bindings: %s", err)
+	}
+}
+
+// newChain returns an empty command chain using the execution options
+func newChain(opts config.ExecOptions) *command.Chain {
+	return &command.Chain{Debug: opts.Debug, Timeout: opts.CommandTimeout, Tmux: opts.Tmux}
+}
+
 // ----------------------------------------------------------------------------
 // TMUX Helpers ---------------------------------------------------------------
 // ----------------------------------------------------------------------------
-func startServer() {
-	cmd := exec.Command("tmux", "start-server")
-	if err := cmd.Run(); err != nil {
-		os.Stderr.WriteString("could not start tmux server")
-		os.Exit(1)
+
+// tmuxFlags returns how to invoke tmux according to the global flags and the
+// GMUX_TMUX environment variable
+func tmuxFlags(c *cli.Context) command.Tmux {
+	return command.Tmux{
+		Binary:     os.Getenv("GMUX_TMUX"),
+		Socket:     c.GlobalString("socket-name"),
+		SocketPath: c.GlobalString("socket-path"),
 	}
 }
 
-func hasSession(name string) bool {
-	cmd := exec.Command("tmux", "has-session", "-t", name)
-	err := cmd.Run()
-	return err == nil
+// startServer starts the tmux server, unless it is running already
+func startServer(ctx context.Context, c *cli.Context, t command.Tmux) error {
+	if _, err := tmuxChain(c, t).Output(ctx, "tmux", "start-server"); err != nil {
+		return fmt.Errorf("could not start tmux server: %s", err)
+	}
+	return nil
+}
+
+// checks for a session with exactly the given name on the server t
+func hasSession(ctx context.Context, c *cli.Context, t command.Tmux, name string) bool {
+	return config.HasSession(ctx, tmuxChain(c, t), name)
+}
+
+func killSession(ctx context.Context, c *cli.Context, t command.Tmux, name string) error {
+	_, err := tmuxChain(c, t).Output(ctx, "tmux", "kill-session", "-t", "="+name)
+	return err
+}
+
+// attach attaches to the session on the server t, or switches to it when
+// run inside tmux
+func attach(ctx context.Context, c *cli.Context, t command.Tmux, name string) error {
+	if err := config.AttachToSession(ctx, tmuxChain(c, t), name); err != nil {
+		return cli.NewExitError(fmt.Sprintf("could not attach to session %q", name), 1)
+	}
+	return nil
+}
+
+// sessionGoneTimeout limits how long to wait for a killed session to go away
+const sessionGoneTimeout = 5 * time.Second
+
+// waitSessionGone waits until a killed session is gone. Killing the last
+// session of a server makes the server exit, and until it has, starting a
+// session fails with "server exited unexpectedly".
+func waitSessionGone(ctx context.Context, c *cli.Context, t command.Tmux, name string) error {
+	cc := tmuxChain(c, t)
+	deadline := time.Now().Add(sessionGoneTimeout)
+	for {
+		out, err := cc.Output(ctx, "tmux", "list-sessions", "-F", "#{session_name}")
+		if err == nil && !containsLine(out, name) {
+			return nil
+		}
+		if err != nil && config.NoServer(err) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("session %q is still shutting down", name)
+		}
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// containsLine reports whether one of the lines of out is line
+func containsLine(out, line string) bool {
+	for _, l := range strings.Split(out, "\n") {
+		if l == line {
+			return true
+		}
+	}
+	return false
 }
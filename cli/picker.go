@@ -0,0 +1,428 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/davinche/gmux/command"
+	"github.com/davinche/gmux/config"
+	"github.com/urfave/cli"
+)
+
+// Kinds of entries in the picker
+const (
+	pickConfig  = "config"
+	pickSession = "session"
+)
+
+// pickItem is an entry in the interactive picker
+type pickItem struct {
+	kind   string
+	name   string
+	detail string // shown next to the name
+
+	tmux command.Tmux // the server a session runs on
+
+	preview []string // lines describing the item, loaded when first shown
+	loaded  bool
+	load    func() []string
+}
+
+// Pick lets the user choose a config or a running session with a fuzzy
+// filter, then starts or attaches to it. Without a terminal, or with nothing
+// to choose from, it shows the help instead.
+func Pick(c *cli.Context) error {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return ShowHelp(c)
+	}
+
+	ctx, cancel := newContext(c)
+	items, err := pickItems(ctx, c)
+	cancel()
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+	if len(items) == 0 {
+		return ShowHelp(c)
+	}
+
+	// Terminals that can't be set up, e.g. when stty is missing, get the
+	// help as well
+	restore, err := makeRaw()
+	if err != nil {
+		return ShowHelp(c)
+	}
+	item, err := runPicker(items)
+	restore()
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+	if item == nil {
+		return nil
+	}
+	if item.kind == pickSession {
+		ctx, cancel := newContext(c)
+		defer cancel()
+		return attach(ctx, c, item.tmux, item.name)
+	}
+	if err := start(c, []string{item.name}); err != nil {
+		return err
+	}
+
+	// Configs only attach on their own when they ask to, but picking one
+	// means wanting to be in it
+	cfg, err := config.Get(item.name)
+	if err != nil || cfg.IsGroup() {
+		return nil
+	}
+	ctx, cancel = newContext(c)
+	defer cancel()
+	return attach(ctx, c, cfg.Tmux(tmuxFlags(c)), cfg.Name)
+}
+
+// pickItems lists the running sessions followed by the configs
+func pickItems(ctx context.Context, c *cli.Context) ([]*pickItem, error) {
+	cc := newChain(execOptions(ctx, c))
+	sessions, err := config.ListAllSessions(ctx, cc)
+	if err != nil {
+		return nil, err
+	}
+	summaries, err := config.Summaries(sessions)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*pickItem
+	for _, s := range sessions {
+		name := s.Name
+		detail := fmt.Sprintf("session, %d windows", len(s.Windows))
+		if s.Clients > 0 {
+			detail += ", attached"
+		}
+		if s.Socket != "" {
+			detail += ", socket " + s.Socket
+		}
+		sc := cc.Clone()
+		sc.Tmux = s.Tmux
+		items = append(items, &pickItem{
+			kind:   pickSession,
+			name:   name,
+			detail: detail,
+			tmux:   s.Tmux,
+			load: func() []string {
+				// The picker has its own timeouts, so use a fresh context
+				return previewSession(context.Background(), sc, name)
+			},
+		})
+	}
+	for _, s := range summaries {
+		name := s.Name
+		detail := s.Description
+		if s.Error != "" {
+			detail = "invalid config"
+		}
+		items = append(items, &pickItem{
+			kind:   pickConfig,
+			name:   name,
+			detail: detail,
+			load: func() []string {
+				return previewConfig(name)
+			},
+		})
+	}
+	return items, nil
+}
+
+// previewConfig describes the windows and panes of a config
+func previewConfig(name string) []string {
+	cfg, err := config.Get(name)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	if cfg.IsGroup() {
+		return []string{"group: " + strings.Join(cfg.Configs, ", ")}
+	}
+
+	lines := []string{"root: " + cfg.Root}
+	if cfg.Description != "" {
+		lines = append(lines, cfg.Description)
+	}
+	for _, w := range cfg.Windows {
+		lines = append(lines, "", fmt.Sprintf("window %s", w.Name))
+		for idx, p := range w.Panes {
+			lines = append(lines, fmt.Sprintf("  %d: %s", idx, p.CommandLine()))
+		}
+	}
+	return lines
+}
+
+// previewSession describes the windows and panes of a running session
+func previewSession(ctx context.Context, cc *command.Chain, name string) []string {
+	windows, err := config.Inspect(ctx, cc, name)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var lines []string
+	for _, w := range windows {
+		lines = append(lines, fmt.Sprintf("window %s", w.Name))
+		for idx, p := range w.Panes {
+			lines = append(lines, fmt.Sprintf("  %d: %s  %s", idx, p.Command, p.Path))
+		}
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+// ----------------------------------------------------------------------------
+// Picker UI ------------------------------------------------------------------
+// ----------------------------------------------------------------------------
+
+// picker holds the state of the interactive picker
+type picker struct {
+	items    []*pickItem
+	query    string
+	matches  []*pickItem
+	selected int
+}
+
+// runPicker shows the picker until an item is chosen (returned) or the
+// picker is cancelled (nil). The terminal must be in raw mode.
+func runPicker(items []*pickItem) (*pickItem, error) {
+	// Use the alternate screen so the picker doesn't clutter the scrollback
+	fmt.Fprint(os.Stdout, "\x1b[?1049h")
+	defer fmt.Fprint(os.Stdout, "\x1b[?1049l")
+
+	p := &picker{items: items}
+	p.filter()
+	buf := make([]byte, 16)
+	for {
+		p.render()
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		key := buf[:n]
+		switch {
+		case len(key) >= 3 && key[0] == 27 && key[1] == '[' && key[2] == 'A', key[0] == 16: // up, Ctrl-P
+			p.move(-1)
+		case len(key) >= 3 && key[0] == 27 && key[1] == '[' && key[2] == 'B', key[0] == 14: // down, Ctrl-N
+			p.move(1)
+		case key[0] == 27 && len(key) == 1, key[0] == 3, key[0] == 4: // Esc, Ctrl-C, Ctrl-D
+			return nil, nil
+		case key[0] == '\r' || key[0] == '\n':
+			if len(p.matches) == 0 {
+				continue
+			}
+			return p.matches[p.selected], nil
+		case key[0] == 127 || key[0] == 8: // backspace
+			if q := []rune(p.query); len(q) > 0 {
+				p.query = string(q[:len(q)-1])
+				p.filter()
+			}
+		case key[0] == 21: // Ctrl-U
+			p.query = ""
+			p.filter()
+		case key[0] >= 32 && key[0] != 127:
+			p.query += string(key)
+			p.filter()
+		}
+	}
+}
+
+// filter keeps the items matching the query, best matches first
+func (p *picker) filter() {
+	type match struct {
+		item  *pickItem
+		score int
+	}
+	var matches []match
+	for _, item := range p.items {
+		if score, ok := fuzzyScore(p.query, item.name); ok {
+			matches = append(matches, match{item, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score < matches[j].score
+	})
+
+	p.matches = p.matches[:0]
+	for _, m := range matches {
+		p.matches = append(p.matches, m.item)
+	}
+	p.selected = 0
+}
+
+// move changes the selected item, wrapping around at either end
+func (p *picker) move(delta int) {
+	if len(p.matches) == 0 {
+		return
+	}
+	p.selected = (p.selected + delta + len(p.matches)) % len(p.matches)
+}
+
+// render draws the query, the matching items and a preview of the selected
+// item next to them when the terminal is wide enough
+func (p *picker) render() {
+	rows, cols := terminalSize()
+	listWidth, previewWidth := cols, 0
+	if cols >= 80 {
+		listWidth = cols / 2
+		previewWidth = cols - listWidth - 3
+	}
+
+	var preview []string
+	if len(p.matches) > 0 && previewWidth > 0 {
+		item := p.matches[p.selected]
+		if !item.loaded {
+			item.preview, item.loaded = item.load(), true
+		}
+		preview = item.preview
+	}
+
+	// Keep the selected item in view
+	height := rows - 2
+	offset := 0
+	if p.selected >= height {
+		offset = p.selected - height + 1
+	}
+
+	var out strings.Builder
+	out.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(&out, "> %s\r\n", p.query)
+	fmt.Fprintf(&out, "\x1b[2m  %d/%d\x1b[0m", len(p.matches), len(p.items))
+	for row := 0; row < height; row++ {
+		line := ""
+		if idx := offset + row; idx < len(p.matches) {
+			item := p.matches[idx]
+			line = truncate(fmt.Sprintf("  %-8s %s  %s", item.kind, item.name, item.detail), listWidth)
+			if idx == p.selected {
+				line = "\x1b[7m" + line + strings.Repeat(" ", listWidth-len([]rune(line))) + "\x1b[0m"
+			}
+		}
+		out.WriteString("\r\n")
+		out.WriteString(line)
+		if previewWidth > 0 {
+			out.WriteString(strings.Repeat(" ", maxInt(0, listWidth-visibleLen(line))))
+			out.WriteString(" │ ")
+			if row < len(preview) {
+				out.WriteString(truncate(preview[row], previewWidth))
+			}
+		}
+	}
+	fmt.Fprintf(&out, "\x1b[1;%dH", len([]rune(p.query))+3)
+	os.Stdout.WriteString(out.String())
+}
+
+// fuzzyScore reports whether every character of the query appears in s in
+// order (ignoring case), along with a score that is lower for closer matches
+func fuzzyScore(query, s string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	score, last, qi := 0, -1, 0
+	for i, r := range []rune(strings.ToLower(s)) {
+		if qi == len(q) {
+			break
+		}
+		if r != q[qi] {
+			continue
+		}
+		if last == -1 {
+			score += i
+		} else {
+			score += i - last - 1
+		}
+		last = i
+		qi++
+	}
+	return score, qi == len(q)
+}
+
+// truncate shortens s to at most width characters
+func truncate(s string, width int) string {
+	r := []rune(s)
+	if len(r) <= width {
+		return s
+	}
+	if width <= 0 {
+		return ""
+	}
+	return string(r[:width])
+}
+
+// visibleLen is the length of s without ANSI escape sequences
+func visibleLen(s string) int {
+	n, escape := 0, false
+	for _, r := range s {
+		switch {
+		case r == 27:
+			escape = true
+		case escape && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'):
+			escape = false
+		case !escape:
+			n++
+		}
+	}
+	return n
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// ----------------------------------------------------------------------------
+// Terminal Helpers -----------------------------------------------------------
+// ----------------------------------------------------------------------------
+
+// isTerminal reports whether the file is a terminal, i.e. has terminal
+// attributes. Other character devices such as /dev/null don't.
+func isTerminal(f *os.File) bool {
+	var termios syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), ioctlGetTermios, uintptr(unsafe.Pointer(&termios)))
+	return errno == 0
+}
+
+// makeRaw puts the terminal into raw mode and returns a function restoring it
+func makeRaw() (func(), error) {
+	state, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("could not read terminal state: %s", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, fmt.Errorf("could not set up terminal: %s", err)
+	}
+	return func() { stty(state) }, nil
+}
+
+// terminalSize returns the number of rows and columns of the terminal
+func terminalSize() (int, int) {
+	rows, cols := 24, 80
+	out, err := stty("size")
+	if err != nil {
+		return rows, cols
+	}
+	if fields := strings.Fields(out); len(fields) == 2 {
+		if r, err := strconv.Atoi(fields[0]); err == nil && r > 2 {
+			rows = r
+		}
+		if c, err := strconv.Atoi(fields[1]); err == nil && c > 0 {
+			cols = c
+		}
+	}
+	return rows, cols
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
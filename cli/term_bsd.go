@@ -0,0 +1,9 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package cli
+
+import "syscall"
+
+// ioctlGetTermios is the ioctl reading a terminal's attributes
+const ioctlGetTermios = syscall.TIOCGETA
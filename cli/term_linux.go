@@ -0,0 +1,6 @@
+package cli
+
+import "syscall"
+
+// ioctlGetTermios is the ioctl reading a terminal's attributes
+const ioctlGetTermios = syscall.TCGETS
@@ -1,15 +1,29 @@
 package command
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os/exec"
 	"strings"
+	"time"
 )
 
 // Chain contains a list of commands to run consecutively
 type Chain struct {
 	commands [][]string
 	Debug    bool
+
+	// Timeout limits how long each individual command may run (0 means no limit)
+	Timeout time.Duration
+
+	// Tmux is applied to every command of the chain that runs "tmux"
+	Tmux Tmux
+}
+
+// Clone returns a new, empty chain with the same settings
+func (c *Chain) Clone() *Chain {
+	return &Chain{Debug: c.Debug, Timeout: c.Timeout, Tmux: c.Tmux}
 }
 
 // Add to the chain of commands
@@ -17,21 +31,58 @@ func (c *Chain) Add(args ...string) {
 	c.commands = append(c.commands, args)
 }
 
-// Run the chain of commands
-func (c *Chain) Run() error {
+// Run the chain of commands. Running stops at the first failing command or
+// as soon as the context is cancelled.
+func (c *Chain) Run(ctx context.Context) error {
 	for _, command := range c.commands {
-		if c.Debug {
-			log.Printf("debug: executing: %s", strings.Join(command, " "))
-		}
-		var cmd *exec.Cmd
-		if len(command) == 0 {
-			cmd = exec.Command(command[0])
-		} else {
-			cmd = exec.Command(command[0], command[1:]...)
+		if err := ctx.Err(); err != nil {
+			return err
 		}
-		if err := cmd.Run(); err != nil {
+		if _, err := c.run(ctx, command); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// Output runs a single command immediately, outside of the chain, and returns
+// its standard output with surrounding whitespace removed
+func (c *Chain) Output(ctx context.Context, args ...string) (string, error) {
+	out, err := c.run(ctx, args)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// run executes a single command, applying the per-command timeout
+func (c *Chain) run(ctx context.Context, command []string) ([]byte, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	if command[0] == "tmux" {
+		command = c.Tmux.Command(command[1:]...)
+	}
+	if c.Debug {
+		log.Printf("debug: executing: %s", strings.Join(command, " "))
+	}
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	out, err := exec.CommandContext(ctx, command[0], command[1:]...).Output()
+	if err != nil {
+		// Report the context error instead of "signal: killed" so callers
+		// can tell a timeout or interrupt apart from a failing command
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("%s: %w", strings.Join(command, " "), ctxErr)
+		}
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("%s: %s", strings.Join(command, " "), strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,32 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestChainEmptyCommand(t *testing.T) {
+	c := &Chain{}
+	if _, err := c.Output(context.Background()); err == nil {
+		t.Errorf("expected an error running an empty command")
+	}
+	c.Add()
+	if err := c.Run(context.Background()); err == nil {
+		t.Errorf("expected an error running a chain with an empty command")
+	}
+}
+
+func TestChainTimeout(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("no sleep to run")
+	}
+	c := &Chain{Timeout: 10 * time.Millisecond}
+	c.Add(sleep, "5")
+	if err := c.Run(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the command to time out, got %v", err)
+	}
+}
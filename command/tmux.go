@@ -0,0 +1,25 @@
+package command
+
+// Tmux describes how to invoke tmux and which tmux server to talk to
+type Tmux struct {
+	Binary     string   // tmux executable to run, "tmux" when empty
+	Options    []string // extra command line options, e.g. -f to use another tmux.conf
+	Socket     string   // socket name, as with `tmux -L`
+	SocketPath string   // socket path, as with `tmux -S`, takes precedence over Socket
+}
+
+// Command returns the command line running tmux with the given arguments
+func (t Tmux) Command(args ...string) []string {
+	binary := t.Binary
+	if binary == "" {
+		binary = "tmux"
+	}
+	cmd := []string{binary}
+	if t.SocketPath != "" {
+		cmd = append(cmd, "-S", t.SocketPath)
+	} else if t.Socket != "" {
+		cmd = append(cmd, "-L", t.Socket)
+	}
+	cmd = append(cmd, t.Options...)
+	return append(cmd, args...)
+}
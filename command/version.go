@@ -0,0 +1,70 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version represents the version of the installed tmux
+type Version struct {
+	Major int
+	Minor int
+
+	// Raw is the unparsed version string as reported by `tmux -V`
+	Raw string
+}
+
+// matches versions such as "3.3a", "next-3.4" or "openbsd-7.3" (whose tmux
+// is versioned with the OS, and is treated as unknown below)
+var versionRegexp = regexp.MustCompile(`^(?:next-)?(\d+)\.(\d+)`)
+
+// ParseVersion parses the output of `tmux -V`
+func ParseVersion(s string) (Version, error) {
+	s = strings.TrimSpace(s)
+	v := Version{Raw: strings.TrimSpace(strings.TrimPrefix(s, "tmux"))}
+	if v.Raw == "" {
+		return v, fmt.Errorf("could not parse tmux version: %q", s)
+	}
+	m := versionRegexp.FindStringSubmatch(v.Raw)
+	if m == nil {
+		// Development builds (e.g. "master") don't carry a version number
+		return v, nil
+	}
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	return v, nil
+}
+
+// TmuxVersion asks the chain's tmux for its version
+func (c *Chain) TmuxVersion(ctx context.Context) (Version, error) {
+	out, err := c.Output(ctx, "tmux", "-V")
+	if err != nil {
+		return Version{}, fmt.Errorf("could not determine tmux version: %w", err)
+	}
+	return ParseVersion(out)
+}
+
+// Known reports whether the version number could be determined
+func (v Version) Known() bool {
+	return v.Major != 0 || v.Minor != 0
+}
+
+// AtLeast reports whether the version is major.minor or newer. Unknown
+// versions are assumed to be recent enough so that development builds and
+// failed detection never block a session from starting.
+func (v Version) AtLeast(major, minor int) bool {
+	if !v.Known() {
+		return true
+	}
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+func (v Version) String() string {
+	if v.Raw == "" {
+		return "unknown"
+	}
+	return v.Raw
+}
@@ -0,0 +1,65 @@
+package command
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in    string
+		major int
+		minor int
+		raw   string
+		err   bool
+	}{
+		{in: "tmux 3.3a", major: 3, minor: 3, raw: "3.3a"},
+		{in: "tmux 2.9\n", major: 2, minor: 9, raw: "2.9"},
+		{in: "tmux 1.8", major: 1, minor: 8, raw: "1.8"},
+		{in: "tmux 3.10", major: 3, minor: 10, raw: "3.10"},
+		{in: "tmux next-3.4", major: 3, minor: 4, raw: "next-3.4"},
+		{in: "tmux master", raw: "master"},
+		{in: "tmux openbsd-7.3", raw: "openbsd-7.3"},
+		{in: "", err: true},
+		{in: "tmux ", err: true},
+	}
+
+	for _, test := range tests {
+		v, err := ParseVersion(test.in)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParseVersion(%q): expected an error", test.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseVersion(%q): unexpected error: %s", test.in, err)
+			continue
+		}
+		if v.Major != test.major || v.Minor != test.minor || v.Raw != test.raw {
+			t.Errorf("ParseVersion(%q) = %d.%d (%q), expected %d.%d (%q)",
+				test.in, v.Major, v.Minor, v.Raw, test.major, test.minor, test.raw)
+		}
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		version      Version
+		major, minor int
+		want         bool
+	}{
+		{Version{Major: 3, Minor: 3}, 3, 1, true},
+		{Version{Major: 3, Minor: 3}, 3, 3, true},
+		{Version{Major: 3, Minor: 3}, 3, 4, false},
+		{Version{Major: 2, Minor: 9}, 3, 0, false},
+		{Version{Major: 3, Minor: 0}, 2, 9, true},
+		// Unknown versions never block anything
+		{Version{Raw: "master"}, 9, 9, true},
+		{Version{}, 1, 8, true},
+	}
+
+	for _, test := range tests {
+		if got := test.version.AtLeast(test.major, test.minor); got != test.want {
+			t.Errorf("%s.AtLeast(%d, %d) = %t, expected %t",
+				test.version, test.major, test.minor, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/davinche/gmux/command"
+)
+
+// Actions a binding can perform on a pane
+const (
+	BindingRun     = "run"     // send the pane's command to it again
+	BindingRestart = "restart" // kill whatever runs in the pane and start its command over
+	BindingFocus   = "focus"   // select the pane and its window
+)
+
+// Binding maps a key to either a tmux command or a gmux action on a pane.
+// Bindings only fire in the config's session.
+type Binding struct {
+	Key     string // the key, e.g. "r" or "C-t"
+	Table   string `json:",omitempty"` // the key table, "prefix" by default
+	Command string `json:",omitempty"` // tmux command to run, e.g. "display-message hi"
+	Action  string `json:",omitempty"` // gmux action to perform on Pane
+	Pane    string `json:",omitempty"` // pane the action applies to ("name", "window" or "window.pane")
+}
+
+// table returns the key table the binding is installed in
+func (b *Binding) table() string {
+	if b.Table == "" {
+		return "prefix"
+	}
+	return b.Table
+}
+
+// validate checks that the binding can be installed
+func (b *Binding) validate(c *Config) error {
+	if b.Key == "" {
+		return fmt.Errorf("no Key given")
+	}
+	if (b.Command == "") == (b.Action == "") {
+		return fmt.Errorf("exactly one of Command and Action must be given")
+	}
+	if b.Command != "" {
+		if b.Pane != "" {
+			return fmt.Errorf("Pane is only used with an Action")
+		}
+		return nil
+	}
+	switch b.Action {
+	case BindingRun, BindingRestart, BindingFocus:
+	default:
+		return fmt.Errorf("unknown Action %q", b.Action)
+	}
+	if b.Pane == "" {
+		return fmt.Errorf("Action %q needs a Pane", b.Action)
+	}
+	wIdx, pIdx, err := c.findPane(b.Pane)
+	if err != nil {
+		return err
+	}
+	if b.Action != BindingFocus && (pIdx >= len(c.Windows[wIdx].Panes) || len(c.Windows[wIdx].Panes[pIdx].keys("")) == 0) {
+		return fmt.Errorf("Action %q needs a pane with commands", b.Action)
+	}
+	return nil
+}
+
+// sessionNameReserved are the characters a session name can't contain: tmux
+// separates windows and panes in targets with ':' and '.', and ',', '}' and
+// '#' would change the format that limits bindings to the session
+const sessionNameReserved = ":.,}#"
+
+// ValidSessionName reports whether name can be used as a session name
+func ValidSessionName(name string) bool {
+	return !strings.ContainsAny(name, sessionNameReserved)
+}
+
+// bindingGuard is the condition that limits a binding to the given session
+func bindingGuard(session string) string {
+	return "#{==:#{session_name}," + session + "}"
+}
+
+// keyBinding is a key binding as listed by list-keys
+type keyBinding struct {
+	table   string
+	key     string
+	repeat  bool
+	command string // the bound commands, in tmux syntax
+
+	// prefix is "bind-key [-r] -T <table> <key>" as listed, with the key
+	// escaped for tmux's parser
+	prefix string
+}
+
+// parseKeyBinding parses a line of list-keys output, which looks like
+// "bind-key [-r] -T <table> <key> <command>"
+func parseKeyBinding(line string) (keyBinding, bool) {
+	var kb keyBinding
+	line = strings.TrimSpace(line)
+	rest := line
+	next := func() string {
+		rest = strings.TrimLeft(rest, " ")
+		word := rest
+		if i := strings.IndexByte(rest, ' '); i != -1 {
+			word = rest[:i]
+		}
+		rest = rest[len(word):]
+		return word
+	}
+	if next() != "bind-key" {
+		return kb, false
+	}
+	for {
+		switch word := next(); word {
+		case "-r":
+			kb.repeat = true
+		case "-T":
+			kb.table, kb.key = next(), next()
+			kb.prefix = strings.Join(strings.Fields(line[:len(line)-len(rest)]), " ")
+			// Keys special to tmux's parser are listed escaped, e.g. \;
+			if len(kb.key) == 2 && kb.key[0] == '\\' {
+				kb.key = kb.key[1:]
+			}
+			kb.command = strings.TrimSpace(rest)
+			return kb, kb.key != "" && kb.command != ""
+		case "":
+			return kb, false
+		}
+	}
+}
+
+// line returns the bind-key command creating the binding
+func (kb keyBinding) line() string {
+	return kb.prefix + " " + kb.command
+}
+
+// bindingID identifies a key in a key table
+func bindingID(table, key string) string {
+	return table + " " + key
+}
+
+// listKeys returns the key bindings of the server by table and key
+func listKeys(ctx context.Context, cc *command.Chain) (map[string]keyBinding, error) {
+	out, err := cc.Output(ctx, "tmux", "list-keys")
+	if err != nil {
+		return nil, err
+	}
+	bindings := map[string]keyBinding{}
+	for _, line := range strings.Split(out, "\n") {
+		if kb, ok := parseKeyBinding(line); ok {
+			bindings[bindingID(kb.table, kb.key)] = kb
+		}
+	}
+	return bindings, nil
+}
+
+// ownedBy reports whether the binding is one gmux installed for the session,
+// i.e. an if-shell limited to the session
+func (kb keyBinding) ownedBy(session string) bool {
+	words := tmuxWords(kb.command)
+	return len(words) >= 4 && words[0] == "if-shell" && words[1] == "-F" && words[2] == bindingGuard(session)
+}
+
+// beneath returns the binding that a binding gmux installed for the session
+// took the place of, which is its else branch. Layers left behind by earlier
+// runs of the session, e.g. when it was killed without `gmux stop`, are
+// skipped as well. It returns false if the key was unbound before.
+func (kb keyBinding) beneath(session string) (keyBinding, bool) {
+	for kb.ownedBy(session) {
+		words := tmuxWords(kb.command)
+		if len(words) < 5 {
+			return keyBinding{}, false
+		}
+		kb.command = words[4]
+	}
+	return kb, true
+}
+
+// bindings queues installing the config's key bindings. Whatever a key was
+// bound to before becomes the binding's else branch, so the key keeps working
+// in other sessions, and is what RemoveBindings restores.
+func (b *builder) bindings(ctx context.Context) error {
+	if len(b.c.Bindings) == 0 {
+		return nil
+	}
+	current, err := listKeys(ctx, b.cc)
+	if err != nil {
+		return err
+	}
+	for _, binding := range b.c.Bindings {
+		cmd := binding.Command
+		if cmd == "" {
+			cmd = b.action(binding)
+		}
+		prev, bound := current[bindingID(binding.table(), binding.Key)]
+		if bound {
+			prev, bound = prev.beneath(b.c.Name)
+		}
+
+		args := []string{"tmux", "bind-key"}
+		if prev.repeat {
+			args = append(args, "-r")
+		}
+		args = append(args, "-T", binding.table(), binding.Key,
+			"if-shell", "-F", bindingGuard(b.c.Name), cmd)
+		if bound {
+			args = append(args, prev.command)
+		}
+		b.cc.Add(args...)
+	}
+	return nil
+}
+
+// action returns the tmux command performing the binding's gmux action
+func (b *builder) action(binding *Binding) string {
+	wIdx, pIdx, _ := b.c.findPane(binding.Pane)
+	paneID := b.paneIDs[wIdx][pIdx]
+	if binding.Action == BindingFocus {
+		return fmt.Sprintf("select-window -t %s ; select-pane -t %s", b.windowIDs[wIdx], paneID)
+	}
+
+	// Steps are sent right away, without their delays
+	var cmds []string
+	if binding.Action == BindingRestart {
+		cmds = append(cmds, "respawn-pane -k -t "+paneID)
+	}
+	for _, keys := range b.c.Windows[wIdx].Panes[pIdx].keys(paneID) {
+		cmds = append(cmds, tmuxCommandString(keys[1:]))
+	}
+	return strings.Join(cmds, " ; ")
+}
+
+// tmuxCommandString turns a tmux command and its arguments into a string
+// tmux parses back into the same arguments
+func tmuxCommandString(args []string) string {
+	quoted := []string{args[0]}
+	// tmux parses single quotes the way the shell does
+	for _, arg := range args[1:] {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// RemoveBindings removes the key bindings gmux installed for the session and
+// restores the ones they took the place of. A binding that has since been
+// wrapped by another session's binding is left in place: it no longer fires
+// once the session is gone, and the key falls through to what it was bound to
+// before.
+func RemoveBindings(ctx context.Context, cc *command.Chain, session string) error {
+	current, err := listKeys(ctx, cc)
+	if err != nil {
+		return err
+	}
+	restore := cc.Clone()
+	for _, kb := range current {
+		if !kb.ownedBy(session) {
+			continue
+		}
+		if prev, ok := kb.beneath(session); ok {
+			// if-shell parses the bind-key command the way a config file
+			// would
+			restore.Add("tmux", "if-shell", "-F", "1", prev.line())
+		} else {
+			restore.Add("tmux", "unbind-key", "-T", kb.table, kb.key)
+		}
+	}
+	return restore.Run(ctx)
+}
+
+// tmuxWords splits a command as tmux lists it into its arguments, undoing
+// tmux's quoting and escaping
+func tmuxWords(s string) []string {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == ' ' || ch == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case ch == '\'':
+			// Single quotes are taken literally
+			inWord = true
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end == -1 {
+				end = len(s) - i - 1
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case ch == '"':
+			inWord = true
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i += tmuxUnescape(&word, s[i+1:])
+					continue
+				}
+				word.WriteByte(s[i])
+			}
+		case ch == '\\' && i+1 < len(s):
+			inWord = true
+			i += tmuxUnescape(&word, s[i+1:])
+		default:
+			inWord = true
+			word.WriteByte(ch)
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// tmuxUnescape writes the character escaped by a backslash at the start of s
+// and returns how many bytes of s it took
+func tmuxUnescape(word *strings.Builder, s string) int {
+	if len(s) >= 3 && isOctal(s[0]) && isOctal(s[1]) && isOctal(s[2]) {
+		word.WriteByte((s[0]-'0')<<6 | (s[1]-'0')<<3 | (s[2] - '0'))
+		return 3
+	}
+	switch s[0] {
+	case 'a':
+		word.WriteByte('\a')
+	case 'b':
+		word.WriteByte('\b')
+	case 'e':
+		word.WriteByte('\033')
+	case 'f':
+		word.WriteByte('\f')
+	case 'n':
+		word.WriteByte('\n')
+	case 'r':
+		word.WriteByte('\r')
+	case 's':
+		word.WriteByte(' ')
+	case 't':
+		word.WriteByte('\t')
+	case 'v':
+		word.WriteByte('\v')
+	default:
+		word.WriteByte(s[0])
+	}
+	return 1
+}
+
+func isOctal(ch byte) bool {
+	return ch >= '0' && ch <= '7'
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"github.com/davinche/gmux/command"
+)
+
+func TestParseKeyBinding(t *testing.T) {
+	tests := []struct {
+		line    string
+		ok      bool
+		table   string
+		key     string
+		repeat  bool
+		command string
+	}{
+		{
+			line:  `bind-key    -T prefix F6      display-message "user binding"`,
+			ok:    true,
+			table: "prefix", key: "F6", command: `display-message "user binding"`,
+		},
+		{
+			line:  `bind-key -r -T prefix Up      select-pane -U`,
+			ok:    true,
+			table: "prefix", key: "Up", repeat: true, command: "select-pane -U",
+		},
+		{
+			line:  `bind-key    -T prefix \"       split-window`,
+			ok:    true,
+			table: "prefix", key: `"`, command: "split-window",
+		},
+		{
+			line:  `bind-key    -T root   C-t     if-shell -F "#{==:#{session_name},api}" "display-message hi"`,
+			ok:    true,
+			table: "root", key: "C-t", command: `if-shell -F "#{==:#{session_name},api}" "display-message hi"`,
+		},
+		{line: "", ok: false},
+		{line: "unknown key: F9", ok: false},
+		{line: "bind-key -T prefix F6", ok: false},
+	}
+
+	for _, test := range tests {
+		kb, ok := parseKeyBinding(test.line)
+		if ok != test.ok {
+			t.Errorf("parseKeyBinding(%q): ok = %t, expected %t", test.line, ok, test.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if kb.table != test.table || kb.key != test.key || kb.repeat != test.repeat || kb.command != test.command {
+			t.Errorf("parseKeyBinding(%q) = %q %q %t %q, expected %q %q %t %q", test.line,
+				kb.table, kb.key, kb.repeat, kb.command, test.table, test.key, test.repeat, test.command)
+		}
+	}
+}
+
+func TestKeyBindingOwnedBy(t *testing.T) {
+	kb, _ := parseKeyBinding(`bind-key -T prefix r if-shell -F "#{==:#{session_name},api}" "display-message a" "display-message b"`)
+	if !kb.ownedBy("api") {
+		t.Errorf("binding should belong to session api")
+	}
+	if kb.ownedBy("ap") || kb.ownedBy("web") {
+		t.Errorf("binding should only belong to session api")
+	}
+
+	// A session's binding in the else branch of another's isn't its own
+	kb, _ = parseKeyBinding(`bind-key -T prefix r if-shell -F "#{==:#{session_name},web}" "display-message a" "if-shell -F '#{==:#{session_name},api}' 'display-message b'"`)
+	if kb.ownedBy("api") {
+		t.Errorf("wrapped binding should not belong to session api")
+	}
+}
+
+func TestTmuxWords(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{`display-message hi`, []string{"display-message", "hi"}},
+		{`display-message "user binding"`, []string{"display-message", "user binding"}},
+		{`if-shell -F "#{==:#{session_name},a}" "send-keys -l 'x y'" "display-message \"it's\""`,
+			[]string{"if-shell", "-F", "#{==:#{session_name},a}", "send-keys -l 'x y'", `display-message "it's"`}},
+		{`if-shell -F '#{==:#{session_name},b}' 'display-message '\''from b'\'''`,
+			[]string{"if-shell", "-F", "#{==:#{session_name},b}", "display-message 'from b'"}},
+		{`send-keys \; "a\\b\$x"`, []string{"send-keys", ";", `a\b$x`}},
+		{`display-message "\101\tb"`, []string{"display-message", "A\tb"}},
+	}
+	for _, test := range tests {
+		if got := tmuxWords(test.in); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("tmuxWords(%q) = %q, expected %q", test.in, got, test.want)
+		}
+	}
+}
+
+// TestBindingsKilledSession starts a session with a binding over a user's
+// own, kills it without removing the binding, starts it again and stops it,
+// on a tmux server of its own
+func TestBindingsKilledSession(t *testing.T) {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux is not installed")
+	}
+	dir, err := ioutil.TempDir("", "gmux-bindings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	t.Setenv("TMUX_TMPDIR", dir)
+	t.Setenv("TMUX", "")
+
+	ctx := context.Background()
+	cc := &command.Chain{Tmux: command.Tmux{Socket: "test", Options: []string{"-f", "/dev/null"}}}
+	tmux := func(args ...string) string {
+		out, err := cc.Output(ctx, append([]string{"tmux"}, args...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	defer cc.Output(ctx, "tmux", "kill-server")
+	const user = `bind-key -T prefix F7 display-message "user binding"`
+
+	tmux("new-session", "-d", "-s", "other")
+	tmux("if-shell", "-F", "1", user)
+	c := &Config{Name: "api", Bindings: []*Binding{{Key: "F7", Command: "display-message api"}}}
+	start := func() {
+		tmux("new-session", "-d", "-s", c.Name)
+		b := newBuilder(c, cc.Clone(), dir)
+		if err := b.bindings(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.run(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	binding := func() keyBinding {
+		kb, _ := parseKeyBinding(tmux("list-keys", "-T", "prefix", "F7"))
+		return kb
+	}
+
+	start()
+	tmux("kill-session", "-t", "=api")
+	start()
+	kb := binding()
+	if words := tmuxWords(kb.command); !kb.ownedBy("api") || len(words) != 5 || words[4] != `display-message "user binding"` {
+		t.Fatalf("expected the session's binding to wrap the user's once, got %q", kb.line())
+	}
+
+	if err := RemoveBindings(ctx, cc, "api"); err != nil {
+		t.Fatal(err)
+	}
+	if kb := binding(); kb.line() != user {
+		t.Fatalf("expected the user's binding to be restored, got %q", kb.line())
+	}
+}
@@ -0,0 +1,333 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/davinche/gmux/command"
+)
+
+// builder creates the windows and panes of a session and queues their
+// commands. Windows and panes are addressed by their tmux IDs (@1, %3) rather
+// than by index so that base-index, pane-base-index and renumber-windows don't
+// matter.
+type builder struct {
+	c       *Config
+	cc      *command.Chain
+	rootAbs string
+
+	// tmux IDs of each window in the config and of the panes in each window
+	windowIDs []string
+	paneIDs   [][]string
+
+	// panes whose commands are held back until they are ready to start
+	scheduled []scheduledPane
+}
+
+func newBuilder(c *Config, cc *command.Chain, rootAbs string) *builder {
+	return &builder{
+		c:         c,
+		cc:        cc,
+		rootAbs:   rootAbs,
+		windowIDs: make([]string, len(c.Windows)),
+		paneIDs:   make([][]string, len(c.Windows)),
+	}
+}
+
+// build creates the session's windows and panes and runs their commands
+func (c *Config) build(ctx context.Context, cc *command.Chain, rootAbs string, opts ExecOptions) (err error) {
+	// Create the tmux session
+	firstWindowRoot := rootAbs
+	if c.Windows[0].Root != "" {
+		firstWindowRoot = expandPath(c.Windows[0].Root)
+	}
+	cc.Add("tmux", "start-server")
+	if err := cc.Run(ctx); err != nil {
+		return err
+	}
+	args := []string{"tmux", "new-session", "-d", "-P", "-F", idFormat,
+		"-s", c.Name, "-n", c.Windows[0].Name, "-c", escapeFormat(firstWindowRoot)}
+	// Detached sessions are 80x24 otherwise, which layouts are computed for
+	width, height := c.size(opts)
+	if width > 0 && height > 0 {
+		args = append(args, "-x", strconv.Itoa(width), "-y", strconv.Itoa(height))
+	}
+	if featureSessionEnv.supportedBy(opts.TmuxVersion) {
+		// Older versions only get the environment from set-environment
+		// below, after the first pane has started
+		for _, env := range c.environment() {
+			args = append(args, "-e", env[0]+"="+env[1])
+		}
+	}
+	args = append(args, c.Windows[0].startCommand(0)...)
+	out, err := cc.Output(ctx, args...)
+	if err != nil {
+		return err
+	}
+	// A session that can't be set up completely, e.g. because a pane's
+	// WaitFor timed out or gmux was interrupted, is killed rather than left
+	// for the next start to attach to
+	defer func() {
+		if err != nil {
+			c.cleanup(opts)
+		}
+	}()
+
+	// Tag the session so `gmux ps` can tell which config it was started from,
+	// and set its options before any more windows are created
+	options, err := c.Options.list(false)
+	if err != nil {
+		return err
+	}
+	setup := cc.Clone()
+	setup.Add("tmux", "set-option", "-t", "="+c.Name+":", sessionConfigOption, c.ConfigName())
+	for _, env := range c.environment() {
+		setup.Add("tmux", "set-environment", "-t", "="+c.Name+":", env[0], env[1])
+	}
+	if width > 0 && height > 0 && featureDefaultSize.supportedBy(opts.TmuxVersion) {
+		// Since tmux 2.9, windows created while no client is attached are
+		// sized by default-size rather than by the session
+		setup.Add("tmux", "set-option", "-t", "="+c.Name+":", "default-size", fmt.Sprintf("%dx%d", width, height))
+	}
+	for _, o := range options {
+		setup.Add("tmux", "set-option", "-t", "="+c.Name+":", o.name, o.value)
+	}
+	if err := setup.Run(ctx); err != nil {
+		return err
+	}
+
+	// Create the windows
+	b := newBuilder(c, cc.Clone(), rootAbs)
+	for idx := range c.Windows {
+		// First window is created automatically, so only create a new window if we're not
+		// looking at the first one
+		if idx != 0 {
+			if err := b.addWindow(ctx, idx); err != nil {
+				return err
+			}
+			continue
+		}
+		winID, firstPaneID, err := parseIDs(out)
+		if err != nil {
+			return err
+		}
+		b.windowIDs[idx] = winID
+		b.paneIDs[idx] = []string{firstPaneID}
+		if err := b.windowOptions(ctx, idx); err != nil {
+			return err
+		}
+		if err := b.addPanes(ctx, idx, 0); err != nil {
+			return err
+		}
+		b.layout(idx)
+	}
+
+	// Select Starting Window
+	winIdx, err := c.startupWindowIndex()
+	if err != nil {
+		return err
+	}
+	paneIdx, err := c.startupPaneIndex(winIdx)
+	if err != nil {
+		return err
+	}
+	b.cc.Add("tmux", "select-window", "-t", b.windowIDs[winIdx])
+	b.cc.Add("tmux", "select-pane", "-t", b.paneIDs[winIdx][paneIdx])
+	if err := b.bindings(ctx); err != nil {
+		return err
+	}
+
+	return b.run(ctx)
+}
+
+// environment returns the variables set in the session's panes, telling
+// their commands which session and config they belong to
+func (c *Config) environment() [][2]string {
+	return [][2]string{
+		{"GMUX_SESSION", c.Name},
+		{"GMUX_CONFIG", c.ConfigName()},
+	}
+}
+
+// size returns the size to create the session with, which is the config's own
+// if it has one and otherwise the size of the terminal gmux runs in
+func (c *Config) size(opts ExecOptions) (int, int) {
+	if c.Width > 0 && c.Height > 0 {
+		return c.Width, c.Height
+	}
+	return opts.Width, opts.Height
+}
+
+// windowRoot returns the directory the window's panes start in, escaped for tmux
+func (b *builder) windowRoot(w *Window) string {
+	wRoot := b.rootAbs
+	if w.Root != "" {
+		wRoot = expandPath(w.Root)
+	}
+	return escapeFormat(wRoot)
+}
+
+// addWindow creates the config's window at idx along with its panes
+func (b *builder) addWindow(ctx context.Context, idx int) error {
+	w := b.c.Windows[idx]
+	args := []string{"tmux", "new-window", "-d", "-P", "-F", idFormat,
+		"-t", "=" + b.c.Name + ":", "-n", w.Name, "-c", b.windowRoot(w)}
+	out, err := b.cc.Output(ctx, append(args, w.startCommand(0)...)...)
+	if err != nil {
+		return err
+	}
+	winID, firstPaneID, err := parseIDs(out)
+	if err != nil {
+		return err
+	}
+	b.windowIDs[idx] = winID
+	b.paneIDs[idx] = []string{firstPaneID}
+	if err := b.windowOptions(ctx, idx); err != nil {
+		return err
+	}
+	if err := b.addPanes(ctx, idx, 0); err != nil {
+		return err
+	}
+	b.layout(idx)
+	return nil
+}
+
+// paneBorderFormat is how gmux labels panes when PaneBorderStatus is set
+const paneBorderFormat = " #{pane_index}: #{pane_title} "
+
+// windowOptions sets the options of the window at idx right after it is
+// created, so options such as remain-on-exit are in place before the other
+// panes are split and before commands are typed into any pane. A remote or
+// container first pane is already running by then.
+func (b *builder) windowOptions(ctx context.Context, idx int) error {
+	options, err := b.c.Windows[idx].Options.list(true)
+	if err != nil {
+		return err
+	}
+	// The window's own options come last so they can override gmux's
+	var defaults []option
+	if b.c.PaneBorderStatus != "" {
+		defaults = append(defaults,
+			option{name: "pane-border-status", value: b.c.PaneBorderStatus},
+			option{name: "pane-border-format", value: paneBorderFormat})
+	}
+	if w := b.c.Windows[idx]; w.MainPaneWidth != "" {
+		defaults = append(defaults, option{name: "main-pane-width", value: string(w.MainPaneWidth)})
+	}
+	if w := b.c.Windows[idx]; w.MainPaneHeight != "" {
+		defaults = append(defaults, option{name: "main-pane-height", value: string(w.MainPaneHeight)})
+	}
+	options = append(defaults, options...)
+	set := b.cc.Clone()
+	for _, o := range options {
+		set.Add("tmux", "set-window-option", "-t", b.windowIDs[idx], o.name, o.value)
+	}
+	return set.Run(ctx)
+}
+
+// addPanes creates the panes the window at idx is missing, and queues the
+// commands of every pane from position `from` onwards. Panes before `from` are
+// already running and are left alone.
+func (b *builder) addPanes(ctx context.Context, idx int, from int) error {
+	w := b.c.Windows[idx]
+	panes := b.paneIDs[idx]
+	for pIdx, p := range w.Panes {
+		if pIdx < from {
+			continue
+		}
+
+		// Only "split window" for panes that don't exist yet
+		var paneID string
+		if pIdx < len(panes) {
+			paneID = panes[pIdx]
+		} else {
+			// Split after the last pane so the panes keep the config's order
+			var err error
+			args := []string{"tmux", "split-window", "-d", "-P", "-F", "#{pane_id}",
+				"-t", panes[len(panes)-1], "-c", b.windowRoot(w)}
+			paneID, err = b.cc.Output(ctx, append(args, w.startCommand(pIdx)...)...)
+			if err != nil {
+				return err
+			}
+			panes = append(panes, paneID)
+		}
+
+		if p.Title != "" {
+			b.cc.Add("tmux", "select-pane", "-t", paneID, "-T", p.Title)
+		}
+
+		// Start logging before anything runs in the pane. Remote and
+		// container panes were started with a plain shell for this, and
+		// only now get their command.
+		if w.logged(p) {
+			cmd, err := b.c.pipeCommand(b.c.logFile(idx, pIdx))
+			if err != nil {
+				return err
+			}
+			b.cc.Add("tmux", "pipe-pane", "-o", "-t", paneID, cmd)
+			if start := w.paneCommand(pIdx); len(start) > 0 {
+				b.cc.Add(append([]string{"tmux", "respawn-pane", "-k", "-t", paneID}, start...)...)
+			}
+		}
+
+		// Execute a pre_window command if one is provided. It sets up the
+		// local environment, so remote and container panes go without.
+		if b.c.PreWindow != "" && !w.wrapped(p) {
+			for _, keys := range sendKeys(paneID, b.c.PreWindow, true) {
+				b.cc.Add(keys...)
+			}
+		}
+
+		// Hold the command back if the pane has to wait for something
+		if b.c.scheduled(p) {
+			label := p.Name
+			if label == "" {
+				label = fmt.Sprintf("%s.%d", w.Name, pIdx)
+			}
+			b.scheduled = append(b.scheduled, scheduledPane{label: label, id: paneID, pane: p})
+			continue
+		}
+
+		// execute the commands for a particular pane if they are provided
+		for _, keys := range p.keys(paneID) {
+			b.cc.Add(keys...)
+		}
+	}
+	b.paneIDs[idx] = panes
+	return nil
+}
+
+// layout queues setting the layout of the window at idx
+func (b *builder) layout(idx int) {
+	w := b.c.Windows[idx]
+	wLayout := "tiled"
+	if w.Layout != "" {
+		wLayout = w.Layout
+	}
+	b.cc.Add("tmux", "select-layout", "-t", b.windowIDs[idx], wLayout)
+}
+
+// run runs the queued commands, then starts the held back panes once they
+// are ready
+func (b *builder) run(ctx context.Context) error {
+	if err := b.cc.Run(ctx); err != nil {
+		return err
+	}
+
+	target := func(w *WaitFor) string {
+		if w == nil || w.Pane == "" {
+			return ""
+		}
+		wIdx, pIdx, _ := b.c.findPane(w.Pane)
+		if pIdx >= len(b.paneIDs[wIdx]) {
+			return ""
+		}
+		return b.paneIDs[wIdx][pIdx]
+	}
+	for i, p := range b.scheduled {
+		b.scheduled[i].waitTarget = target(p.pane.WaitFor)
+		b.scheduled[i].readyTarget = target(p.pane.Ready)
+	}
+	return b.c.runScheduled(ctx, b.cc, b.scheduled)
+}
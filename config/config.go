@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -9,8 +10,11 @@ import (
 	"os/user"
 	"path"
 	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"encoding/json"
 
@@ -68,30 +72,228 @@ func init() {
 // Config represents the top level structure of a gmux config
 type Config struct {
 	Name          string
+	Description   string `json:",omitempty"`
 	Root          string
 	Windows       []*Window
-	Attach        bool   `json:",omitempty"`
-	PreWindow     string `json:",omitempty"`
-	StartupWindow string `json:",omitempty"`
-	StartupPane   int    `json:",omitempty"`
+	Attach        bool         `json:",omitempty"`
+	PreWindow     string       `json:",omitempty"`
+	StartupWindow string       `json:",omitempty"`
+	StartupPane   PaneSelector `json:",omitempty"`
+	IfExists      string       `json:",omitempty"`
+
+	// Configs turns the config into a group that starts the listed configs
+	Configs []string `json:",omitempty"`
+
+	// Primary is the config in the group whose session is attached to
+	Primary string `json:",omitempty"`
+
+	// Socket and SocketPath select a tmux server other than the default one
+	// by socket name (tmux -L) or socket path (tmux -S)
+	Socket     string `json:",omitempty"`
+	SocketPath string `json:",omitempty"`
+
+	// TmuxCommand is the tmux executable to use, and TmuxOptions are extra
+	// options passed to it, e.g. "-f ~/.tmux.work.conf"
+	TmuxCommand string `json:",omitempty"`
+	TmuxOptions string `json:",omitempty"`
+
+	// Options are tmux session options set when the session is created
+	Options Options `json:",omitempty"`
+
+	// PaneBorderStatus shows pane titles in the pane borders, at the "top"
+	// or "bottom" of each pane
+	PaneBorderStatus string `json:",omitempty"`
+
+	// Bindings are key bindings installed for the session while it runs
+	Bindings []*Binding `json:",omitempty"`
+
+	// LogDir is where the logs of logged panes are written, in a directory
+	// per session (~/.gmux/logs by default). Logs are rotated once they
+	// reach LogMaxSize, e.g. "10M".
+	LogDir     string `json:",omitempty"`
+	LogMaxSize string `json:",omitempty"`
+
+	// Width and Height are the size the session's windows are created with.
+	// They are set together; when not set, the size of the terminal gmux runs
+	// in is used.
+	Width  int `json:",omitempty"`
+	Height int `json:",omitempty"`
+
+	// the name of the file the config was read from
+	file string
 }
 
 // Window represents the configration for a tmux window
 type Window struct {
-	Name   string
-	Layout string   `json:",omitempty"`
-	Root   string   `json:",omitempty"`
-	Panes  []string `json:",omitempty"`
+	Name    string
+	Layout  string  `json:",omitempty"`
+	Root    string  `json:",omitempty"`
+	Panes   []*Pane `json:",omitempty"`
+	Options Options `json:",omitempty"`
+
+	// MainPaneWidth and MainPaneHeight size the main pane of the
+	// main-vertical and main-horizontal layouts
+	MainPaneWidth  Size `json:",omitempty"`
+	MainPaneHeight Size `json:",omitempty"`
+
+	// Host runs the window's panes over ssh on the given host, starting in
+	// RemoteRoot there
+	Host       string `json:",omitempty"`
+	RemoteRoot string `json:",omitempty"`
+
+	// Log writes the output of all the window's panes to log files
+	Log bool `json:",omitempty"`
+}
+
+// paneCount returns the number of panes the window is created with. A window
+// without panes in the config still has the one it was created with.
+func (w *Window) paneCount() int {
+	if len(w.Panes) == 0 {
+		return 1
+	}
+	return len(w.Panes)
+}
+
+// Pane represents the configuration for a tmux pane. In a config file a pane
+// is either just the command to run or an object with additional settings.
+type Pane struct {
+	Name    string   `json:",omitempty"`
+	Title   string   `json:",omitempty"`
+	Command string   `json:",omitempty"`
+	WaitFor *WaitFor `json:",omitempty"`
+
+	// Commands are run one after another, after Command
+	Commands []*Step `json:",omitempty"`
+
+	// Prefill is typed into the pane after its commands without being run
+	Prefill string `json:",omitempty"`
+
+	// Host runs the pane over ssh on the given host, starting in RemoteRoot
+	// there. Both override the window's.
+	Host       string `json:",omitempty"`
+	RemoteRoot string `json:",omitempty"`
+
+	// Container runs the pane's commands in a shell inside a container
+	Container *Container `json:",omitempty"`
+
+	// Log writes the pane's output to a log file
+	Log bool `json:",omitempty"`
+
+	// DependsOn names the panes that must be ready before this pane starts
+	DependsOn []string `json:",omitempty"`
+
+	// Ready holds the conditions that mark this pane as ready for the panes
+	// depending on it. Without it, the pane is ready once its command is sent.
+	Ready *WaitFor `json:",omitempty"`
+}
+
+// pane has the same fields as Pane without its JSON methods
+type pane Pane
+
+// PaneSelector selects a pane of a window either by its position (starting
+// from 0) or by its title. In a config file it is a number or a string.
+type PaneSelector string
+
+// UnmarshalJSON accepts both numbers and strings
+func (s *PaneSelector) UnmarshalJSON(data []byte) error {
+	var idx int
+	if err := json.Unmarshal(data, &idx); err == nil {
+		*s = PaneSelector(strconv.Itoa(idx))
+		return nil
+	}
+	return json.Unmarshal(data, (*string)(s))
+}
+
+// MarshalJSON writes positions as numbers
+func (s PaneSelector) MarshalJSON() ([]byte, error) {
+	if idx, err := strconv.Atoi(string(s)); err == nil {
+		return json.Marshal(idx)
+	}
+	return json.Marshal(string(s))
+}
+
+// UnmarshalJSON accepts either a command string or a pane object
+func (p *Pane) UnmarshalJSON(data []byte) error {
+	var cmd string
+	if err := json.Unmarshal(data, &cmd); err == nil {
+		*p = Pane{Command: cmd}
+		return nil
+	}
+	return json.Unmarshal(data, (*pane)(p))
+}
+
+// MarshalJSON writes panes that only have a command as a plain string
+func (p *Pane) MarshalJSON() ([]byte, error) {
+	if reflect.DeepEqual(*p, Pane{Command: p.Command}) {
+		return json.Marshal(p.Command)
+	}
+	return json.Marshal((*pane)(p))
+}
+
+// Policies for starting a config whose session already exists
+const (
+	IfExistsAttach    = "attach"    // attach to the running session
+	IfExistsRecreate  = "recreate"  // kill the running session and start over
+	IfExistsReconcile = "reconcile" // add what is missing from the running session, then attach
+	IfExistsFail      = "fail"      // exit with an error
+)
+
+// ValidIfExists reports whether policy is a known IfExists policy
+func ValidIfExists(policy string) bool {
+	switch policy {
+	case IfExistsAttach, IfExistsRecreate, IfExistsReconcile, IfExistsFail:
+		return true
+	}
+	return false
+}
+
+// ExecOptions controls how a gmux configuration is executed
+type ExecOptions struct {
+	Debug bool
+
+	// CommandTimeout limits how long each tmux command may take (0 means no limit)
+	CommandTimeout time.Duration
+
+	// TmuxVersion is the version of the tmux described by Tmux, used to
+	// check that the config only relies on features it supports
+	TmuxVersion command.Version
+
+	// Detached skips attaching to the session even if the config asks for it
+	Detached bool
+
+	// Width and Height are the size of the terminal the session will be
+	// attached to, used unless the config has its own (0 leaves it to tmux)
+	Width  int
+	Height int
+
+	// Tmux describes how to invoke tmux. Its socket overrides the config's
+	// Socket and SocketPath, while the config's TmuxCommand and TmuxOptions
+	// override its binary and options.
+	Tmux command.Tmux
 }
 
 // Config Methods -------------------------------------------------------------
 
-// Exec runs the gmux configuration
-func (c *Config) Exec(debug bool) error {
-	cc := &command.Chain{Debug: debug}
+// Exec runs the gmux configuration. If the session can't be built completely,
+// e.g. because the context is cancelled or times out, the partially created
+// session is killed.
+func (c *Config) Exec(ctx context.Context, opts ExecOptions) error {
+	debug := opts.Debug
+	cc := c.chain(opts)
+
+	if c.IsGroup() {
+		return fmt.Errorf("config %q is a group and can not be run directly", c.Name)
+	}
+	opts.TmuxVersion = c.tmuxVersion(ctx, cc, opts)
+	if err := c.checkFeatures(opts.TmuxVersion); err != nil {
+		return err
+	}
+	if err := c.checkEngines(); err != nil {
+		return err
+	}
 
 	// CD to tmux config directory
-	rootAbs, err := filepath.Abs(expandPath(c.Root))
+	rootAbs, err := c.rootPath()
 	if err != nil {
 		if debug {
 			log.Printf("error: could not determine absolute path to config directory: err=%q\n", err)
@@ -105,82 +307,131 @@ func (c *Config) Exec(debug bool) error {
 		return err
 	}
 
-	// Create the tmux session
-	firstWindowRoot := rootAbs
-	if c.Windows[0].Root != "" {
-		firstWindowRoot = expandPath(c.Windows[0].Root)
+	if err := c.build(ctx, cc, rootAbs, opts); err != nil {
+		return err
 	}
-	cc.Add("tmux", "start-server")
-	cc.Add("tmux", "new-session", "-d", "-s", c.Name, "-n", c.Windows[0].Name, "-c", firstWindowRoot)
 
-	// Create the windows
-	for idx, w := range c.Windows {
-		winID := fmt.Sprintf("%s:%d", c.Name, idx)
-		wRoot := rootAbs
-		if w.Root != "" {
-			wRoot = expandPath(w.Root)
+	if !c.Attach || opts.Detached {
+		return nil
+	}
+
+	if err := AttachToSession(ctx, cc, c.Name); err != nil {
+		if debug {
+			log.Printf("error: could not attach to session: %q\n", err)
 		}
-		wRoot = escapePath(wRoot)
+		return err
+	}
+	return nil
+}
+
+// ConfigName returns the name the config is stored under, which may differ
+// from the session name
+func (c *Config) ConfigName() string {
+	if c.file != "" {
+		return c.file
+	}
+	return c.Name
+}
 
-		// First window is created automatically, so only create a new window if we're not
-		// looking at the first one
-		if idx != 0 {
-			cc.Add("tmux", "new-window", "-t", winID, "-n", w.Name, "-c", wRoot)
+// Tmux returns how to invoke tmux for the config, starting from base (e.g.
+// the command line flags). A socket given in base takes precedence over the
+// config's, while the config's TmuxCommand and TmuxOptions replace base's
+// binary and options.
+func (c *Config) Tmux(base command.Tmux) command.Tmux {
+	t := base
+	if base.Socket == "" && base.SocketPath == "" {
+		t.Socket = c.Socket
+		t.SocketPath = expandPath(c.SocketPath)
+	}
+	if c.TmuxCommand != "" {
+		t.Binary = expandPath(c.TmuxCommand)
+	}
+	if c.TmuxOptions != "" {
+		t.Options = nil
+		for _, option := range strings.Fields(c.TmuxOptions) {
+			t.Options = append(t.Options, expandPath(option))
 		}
+	}
+	return t
+}
 
-		// Create Panes
-		for idx, p := range w.Panes {
-			paneID := fmt.Sprintf("%s.%d", winID, idx)
+// chain returns an empty command chain running the config's tmux with the
+// execution options
+func (c *Config) chain(opts ExecOptions) *command.Chain {
+	return &command.Chain{Debug: opts.Debug, Timeout: opts.CommandTimeout, Tmux: c.Tmux(opts.Tmux)}
+}
 
-			// Likewise, first pane is created automatically
-			// so only "split window" for subsequent panes
-			if idx != 0 {
-				cc.Add("tmux", "split-window", "-t", winID, "-c", wRoot)
-			}
+// tmuxVersion returns the version of the tmux the chain runs. It only needs
+// to be detected again when the config uses its own tmux executable.
+func (c *Config) tmuxVersion(ctx context.Context, cc *command.Chain, opts ExecOptions) command.Version {
+	if cc.Tmux.Binary == opts.Tmux.Binary {
+		return opts.TmuxVersion
+	}
+	version, err := cc.TmuxVersion(ctx)
+	if err != nil && opts.Debug {
+		log.Printf("debug: %s", err)
+	}
+	return version
+}
 
-			// Execute a pre_window command if one is provided
-			if c.PreWindow != "" {
-				cc.Add("tmux", "send-keys", "-t", paneID, c.PreWindow, "Enter")
-			}
+// rootPath returns the absolute path of the config's root directory
+func (c *Config) rootPath() (string, error) {
+	return filepath.Abs(expandPath(c.Root))
+}
 
-			// execute the command for a particular pane if it is provided
-			if p != "" {
-				cc.Add("tmux", "send-keys", "-t", paneID, p, "Enter")
-			}
+// startupWindowIndex resolves StartupWindow, which may be either a window
+// name or its position in the config (starting from 0)
+func (c *Config) startupWindowIndex() (int, error) {
+	if c.StartupWindow == "" {
+		return 0, nil
+	}
+	for idx, w := range c.Windows {
+		if w.Name == c.StartupWindow {
+			return idx, nil
 		}
+	}
+	if idx, err := strconv.Atoi(c.StartupWindow); err == nil && idx >= 0 && idx < len(c.Windows) {
+		return idx, nil
+	}
+	return 0, fmt.Errorf("invalid StartupWindow: no window named %q", c.StartupWindow)
+}
 
-		// Set window layout
-		wLayout := "tiled"
-		if w.Layout != "" {
-			wLayout = w.Layout
+// startupPaneIndex resolves StartupPane within the window at winIdx. It may
+// be either a pane's title or its position (starting from 0).
+func (c *Config) startupPaneIndex(winIdx int) (int, error) {
+	if c.StartupPane == "" {
+		return 0, nil
+	}
+	w := c.Windows[winIdx]
+	for idx, p := range w.Panes {
+		if p.Title != "" && p.Title == string(c.StartupPane) {
+			return idx, nil
 		}
-		cc.Add("tmux", "select-layout", "-t", winID, wLayout)
 	}
-
-	// Select Starting Window
-	selectWindow := fmt.Sprintf("%s:0", c.Name)
-	if c.StartupWindow != "" {
-		selectWindow = fmt.Sprintf("%s:%s", c.Name, c.StartupWindow)
+	if idx, err := strconv.Atoi(string(c.StartupPane)); err == nil && idx >= 0 && idx < w.paneCount() {
+		return idx, nil
 	}
-	cc.Add("tmux", "select-window", "-t", selectWindow)
-	cc.Add("tmux", "select-pane", "-t", fmt.Sprintf("%s.%d", selectWindow, c.StartupPane))
+	return 0, fmt.Errorf("invalid StartupPane: window %q has no pane %q", w.Name, c.StartupPane)
+}
 
-	// Run our tmux script
-	if err := cc.Run(); err != nil {
-		return err
+// cleanup kills a session that was only partially created
+func (c *Config) cleanup(opts ExecOptions) {
+	if opts.Debug {
+		log.Printf("debug: cleaning up partially created session %q\n", c.Name)
 	}
-
-	if !c.Attach {
-		return nil
+	// The original context is already done, so use a fresh one to make sure
+	// a hung tmux server cannot block us here either
+	ctx := context.Background()
+	if opts.CommandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.CommandTimeout)
+		defer cancel()
 	}
-
-	if err := AttachToSession(c.Name); err != nil {
-		if debug {
-			log.Printf("error: could not attach to session: %q\n", err)
-		}
-		return err
+	cc := c.chain(opts)
+	cc.Add("tmux", "kill-session", "-t", "="+c.Name)
+	if err := cc.Run(ctx); err != nil && opts.Debug {
+		log.Printf("error: could not clean up session: %q\n", err)
 	}
-	return nil
 }
 
 // Write the config to the configurations directory
@@ -200,28 +451,29 @@ func New(configName string) *Config {
 		Name:    configName,
 		Root:    "~/",
 		Windows: make([]*Window, 3),
+		file:    configName,
 	}
 
 	config.Windows[0] = &Window{
 		Name:   "editor",
 		Layout: "main-vertical",
-		Panes: []string{
-			"vim",
-			"guard",
+		Panes: []*Pane{
+			{Command: "vim"},
+			{Command: "guard"},
 		},
 	}
 
 	config.Windows[1] = &Window{
 		Name: "server",
-		Panes: []string{
-			"bundle exec rails s",
+		Panes: []*Pane{
+			{Command: "bundle exec rails s"},
 		},
 	}
 
 	config.Windows[2] = &Window{
 		Name: "logs",
-		Panes: []string{
-			"tail -f log/development.log",
+		Panes: []*Pane{
+			{Command: "tail -f log/development.log"},
 		},
 	}
 
@@ -230,7 +482,7 @@ func New(configName string) *Config {
 
 // Get returns the config for a given config name
 func Get(config string) (*Config, error) {
-	c := &Config{}
+	c := &Config{file: config}
 	if !Exists(config) {
 		return nil, fmt.Errorf("could not find config: %s", config)
 	}
@@ -244,37 +496,236 @@ func Get(config string) (*Config, error) {
 		return nil, err
 	}
 
+	if c.IsGroup() {
+		return c, nil
+	}
 	if c.Name == "" || c.Root == "" || c.Windows == nil {
 		return nil, fmt.Errorf("invalid config: missing name, root, or windows in the file")
 	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %s", err)
+	}
 	return c, nil
 }
 
+// validate checks the windows and panes of a config
+func (c *Config) validate() error {
+	if len(c.Windows) == 0 {
+		return fmt.Errorf("no windows")
+	}
+	// Panes are looked up across all windows, so check them all first
+	for idx, w := range c.Windows {
+		if w == nil {
+			return fmt.Errorf("window %d is empty", idx)
+		}
+	}
+	if c.IfExists != "" && !ValidIfExists(c.IfExists) {
+		return fmt.Errorf("unknown IfExists policy %q", c.IfExists)
+	}
+	if _, err := c.Options.list(false); err != nil {
+		return err
+	}
+	if _, err := parseByteSize(c.LogMaxSize, defaultLogMaxSize); err != nil {
+		return fmt.Errorf("invalid LogMaxSize: %s", err)
+	}
+	if c.Width < 0 || c.Height < 0 {
+		return fmt.Errorf("invalid size %dx%d", c.Width, c.Height)
+	}
+	if (c.Width == 0) != (c.Height == 0) {
+		return fmt.Errorf("invalid size %dx%d: Width and Height must be set together", c.Width, c.Height)
+	}
+	switch c.PaneBorderStatus {
+	case "", "top", "bottom":
+	default:
+		return fmt.Errorf("invalid PaneBorderStatus %q: expected top or bottom", c.PaneBorderStatus)
+	}
+	for _, w := range c.Windows {
+		if _, err := w.Options.list(true); err != nil {
+			return fmt.Errorf("window %s: %s", w.Name, err)
+		}
+		for name, size := range map[string]Size{"MainPaneWidth": w.MainPaneWidth, "MainPaneHeight": w.MainPaneHeight} {
+			if size == "" {
+				continue
+			}
+			if err := size.validate(); err != nil {
+				return fmt.Errorf("window %s: %s: %s", w.Name, name, err)
+			}
+		}
+		for idx, p := range w.Panes {
+			// Treat null panes like empty ones
+			if p == nil {
+				w.Panes[idx] = &Pane{}
+				continue
+			}
+			if err := p.validateSteps(); err != nil {
+				return fmt.Errorf("pane %s.%d: %s", w.Name, idx, err)
+			}
+			if p.Container != nil {
+				if err := p.Container.validate(); err != nil {
+					return fmt.Errorf("pane %s.%d: Container: %s", w.Name, idx, err)
+				}
+			}
+			if p.WaitFor != nil {
+				if err := p.WaitFor.validate(c); err != nil {
+					return fmt.Errorf("pane %s.%d: WaitFor: %s", w.Name, idx, err)
+				}
+			}
+			if p.Ready != nil {
+				if err := p.Ready.validate(c); err != nil {
+					return fmt.Errorf("pane %s.%d: Ready: %s", w.Name, idx, err)
+				}
+			}
+		}
+	}
+	if len(c.Bindings) > 0 && !ValidSessionName(c.Name) {
+		return fmt.Errorf("Bindings need a session name without any of %q", sessionNameReserved)
+	}
+	for idx, b := range c.Bindings {
+		if b == nil {
+			return fmt.Errorf("empty binding")
+		}
+		if err := b.validate(c); err != nil {
+			return fmt.Errorf("binding %d (%s): %s", idx, b.Key, err)
+		}
+	}
+	return c.validateDependencies()
+}
+
+// IsGroup reports whether the config is a group of other configs
+func (c *Config) IsGroup() bool {
+	return len(c.Configs) > 0
+}
+
+// Expand gets the configs for the given names, replacing groups with the
+// configs they list. It also returns the session name of the primary config:
+// the given primary, else the first group's Primary, else the first config.
+func Expand(names []string, primary string) ([]*Config, string, error) {
+	var configs []*Config
+	byName := make(map[string]*Config)
+	seen := make(map[string]bool)
+
+	var expand func(names []string) error
+	expand = func(names []string) error {
+		for _, name := range names {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			c, err := Get(name)
+			if err != nil {
+				return err
+			}
+			if c.IsGroup() {
+				if primary == "" {
+					primary = c.Primary
+				}
+				if err := expand(c.Configs); err != nil {
+					return fmt.Errorf("group %s: %s", name, err)
+				}
+				continue
+			}
+			byName[name] = c
+			configs = append(configs, c)
+		}
+		return nil
+	}
+	if err := expand(names); err != nil {
+		return nil, "", err
+	}
+	if len(configs) == 0 {
+		return nil, "", fmt.Errorf("no configs to start")
+	}
+
+	if primary == "" {
+		return configs, configs[0].Name, nil
+	}
+	c, ok := byName[primary]
+	if !ok {
+		return nil, "", fmt.Errorf("primary config %q is not being started", primary)
+	}
+	return configs, c.Name, nil
+}
+
 // GetAndRun gets a projects config and executes it
-func GetAndRun(config string, debug bool) error {
+func GetAndRun(ctx context.Context, config string, opts ExecOptions) error {
 	c, err := Get(config)
 	if err != nil {
 		return err
 	}
-	return c.Exec(debug)
+	return c.Exec(ctx, opts)
 }
 
 // List prints out the list of gmux projects
 func List() error {
-	files, err := ioutil.ReadDir(configDir)
+	names, err := Names()
 	if err != nil {
 		return err
 	}
+	for _, name := range names {
+		fmt.Printf("%s\n", name)
+	}
+	return nil
+}
+
+// Names returns the names of all gmux projects
+func Names() ([]string, error) {
+	files, err := ioutil.ReadDir(configDir)
+	if err != nil {
+		return nil, err
+	}
 
+	var names []string
 	for _, file := range files {
 		if file.IsDir() {
 			continue
 		}
 		name := file.Name()
 		ext := filepath.Ext(name)
-		fmt.Printf("%s\n", name[:len(name)-len(ext)])
+		names = append(names, name[:len(name)-len(ext)])
 	}
-	return nil
+	return names, nil
+}
+
+// Summary describes a gmux project for listing
+type Summary struct {
+	Name        string
+	Description string   `json:",omitempty"`
+	Root        string   `json:",omitempty"`
+	Windows     int      `json:",omitempty"`
+	Configs     []string `json:",omitempty"` // the configs of a group
+	Running     bool
+	Error       string `json:",omitempty"` // why the config could not be read
+}
+
+// Summaries describes every gmux project. A project is running if one of the
+// given sessions was started from it or has its session name.
+func Summaries(sessions []*LiveSession) ([]*Summary, error) {
+	names, err := Names()
+	if err != nil {
+		return nil, err
+	}
+
+	var summaries []*Summary
+	for _, name := range names {
+		s := &Summary{Name: name}
+		summaries = append(summaries, s)
+		c, err := Get(name)
+		if err != nil {
+			s.Error = err.Error()
+			continue
+		}
+		s.Description = c.Description
+		s.Root = c.Root
+		s.Windows = len(c.Windows)
+		s.Configs = c.Configs
+		for _, session := range sessions {
+			if session.Config == name || (!c.IsGroup() && session.Name == c.Name) {
+				s.Running = true
+			}
+		}
+	}
+	return summaries, nil
 }
 
 // Edit uses the environment's EDITOR to edit the config
@@ -315,27 +766,26 @@ func Exists(config string) bool {
 }
 
 // AttachToSession attempts to attach to a a currently active tmux session
-func AttachToSession(name string) error {
-	// Replace current context with tmux attach session
-	tmux, err := exec.LookPath("tmux")
-	if err != nil {
+func AttachToSession(ctx context.Context, cc *command.Chain, name string) error {
+	// Switch from our current session to the new one if we're already in tmux
+	if os.Getenv("TMUX") != "" {
+		_, err := cc.Output(ctx, "tmux", "-u", "switch-client", "-t", name)
 		return err
 	}
-	args := []string{"tmux"}
 
-	// Attach to the session if we're not already in tmux.
-	// Otherwise, switch from our current session to the new one
-	if os.Getenv("TMUX") == "" {
-		args = append(args, "-u", "attach-session", "-t", name)
-	} else {
-		args = append(args, "-u", "switch-client", "-t", name)
+	// The attached client runs for as long as the user stays in it, so only
+	// check that the server answers before handing over to it
+	if _, err := cc.Output(ctx, "tmux", "has-session", "-t", name); err != nil {
+		return err
 	}
-
-	// Replace our program context with tmux
-	if sysErr := syscall.Exec(tmux, args, os.Environ()); sysErr != nil {
+	args := cc.Tmux.Command("-u", "attach-session", "-t", name)
+	tmux, err := exec.LookPath(args[0])
+	if err != nil {
 		return err
 	}
-	return nil
+
+	// Replace our program context with tmux
+	return syscall.Exec(tmux, args, os.Environ())
 }
 
 // perform any path expansions the shell would normally do for us
@@ -352,6 +802,21 @@ func getConfigFilePath(configName string) string {
 	return path.Join(configDir, fmt.Sprintf("%s.json", configName))
 }
 
-func escapePath(path string) string {
-	return strings.Replace(path, " ", "\\ ", -1)
+// format used to print the IDs of newly created windows
+const idFormat = "#{window_id} #{pane_id}"
+
+// parses the output of idFormat into a window ID and pane ID
+func parseIDs(out string) (string, string, error) {
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("unexpected output from tmux: %q", out)
+	}
+	return fields[0], fields[1], nil
+}
+
+// escapeFormat quotes a value passed to tmux where it expects a format, such
+// as start directories. Arguments reach tmux without going through a shell,
+// so only format expansion has to be prevented.
+func escapeFormat(s string) string {
+	return strings.ReplaceAll(s, "#", "##")
 }
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateEmptyWindow(t *testing.T) {
+	// The first pane's WaitFor looks up pane b across all windows
+	data := `{"Name": "t", "Windows": [
+		{"Name": "a", "Panes": [{"WaitFor": {"Pane": "b", "Output": "y"}}]},
+		null,
+		{"Name": "b", "Panes": [{"Name": "b"}]}
+	]}`
+	var c Config
+	if err := json.Unmarshal([]byte(data), &c); err != nil {
+		t.Fatal(err)
+	}
+	err := c.validate()
+	if err == nil || !strings.Contains(err.Error(), "window 1 is empty") {
+		t.Fatalf("expected the empty window to be rejected, got %v", err)
+	}
+}
+
+func TestValidateSize(t *testing.T) {
+	tests := []struct {
+		width, height int
+		ok            bool
+	}{
+		{0, 0, true},
+		{120, 40, true},
+		{120, 0, false},
+		{0, 40, false},
+		{-1, 40, false},
+	}
+	for _, test := range tests {
+		c := &Config{Windows: []*Window{{Name: "w"}}, Width: test.width, Height: test.height}
+		if err := c.validate(); (err == nil) != test.ok {
+			t.Errorf("validate() of a %dx%d config = %v, expected ok = %t", test.width, test.height, err, test.ok)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gmux-configs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(dir string) { configDir = dir }(configDir)
+	configDir = dir
+
+	files := map[string]string{
+		"api":   `{"Name": "api", "Root": "~", "Windows": [{"Name": "w"}]}`,
+		"web":   `{"Name": "web", "Root": "~", "Windows": [{"Name": "w"}]}`,
+		"db":    `{"Name": "db", "Root": "~", "Windows": [{"Name": "w"}]}`,
+		"stack": `{"Name": "stack", "Configs": ["api", "web"], "Primary": "web"}`,
+		"all":   `{"Name": "all", "Configs": ["stack", "db", "api"]}`,
+		"loop":  `{"Name": "loop", "Configs": ["loop"]}`,
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name+".json"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		names   []string
+		primary string
+		want    []string
+		attach  string
+		err     string // expected error substring, "" for none
+	}{
+		{names: []string{"api", "db"}, want: []string{"api", "db"}, attach: "api"},
+		{names: []string{"stack"}, want: []string{"api", "web"}, attach: "web"},
+		// Configs are only started once, and nested groups are expanded
+		{names: []string{"all"}, want: []string{"api", "web", "db"}, attach: "web"},
+		{names: []string{"all"}, primary: "db", want: []string{"api", "web", "db"}, attach: "db"},
+		{names: []string{"api"}, primary: "web", err: `primary config "web" is not being started`},
+		{names: []string{"stack", "missing"}, err: "could not find config: missing"},
+		{names: []string{"loop"}, err: "no configs to start"},
+	}
+	for _, test := range tests {
+		configs, attach, err := Expand(test.names, test.primary)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("Expand(%q, %q): unexpected error: %s", test.names, test.primary, err)
+			continue
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("Expand(%q, %q): expected an error containing %q, got %v", test.names, test.primary, test.err, err)
+			continue
+		case test.err != "":
+			continue
+		}
+		var names []string
+		for _, c := range configs {
+			names = append(names, c.Name)
+		}
+		if !reflect.DeepEqual(names, test.want) || attach != test.attach {
+			t.Errorf("Expand(%q, %q) = %q, %q, expected %q, %q", test.names, test.primary, names, attach, test.want, test.attach)
+		}
+	}
+}
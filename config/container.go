@@ -0,0 +1,115 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"strings"
+)
+
+// Container engines gmux can exec into
+const (
+	EngineDocker = "docker"
+	EnginePodman = "podman"
+)
+
+// Container describes the container a pane runs in. In a config file it is
+// either just the container name or an object with additional settings.
+type Container struct {
+	Name string
+
+	// Compose treats Name as a compose service of the project in the
+	// window's root rather than as a container name
+	Compose bool `json:",omitempty"`
+
+	Engine string `json:",omitempty"` // "docker" (default) or "podman"
+	Root   string `json:",omitempty"` // working directory inside the container
+	Shell  string `json:",omitempty"` // shell to start, "sh" by default
+}
+
+// container has the same fields as Container without its JSON methods
+type container Container
+
+// UnmarshalJSON accepts both a plain container name and a container object
+func (c *Container) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*c = Container{Name: name}
+		return nil
+	}
+	return json.Unmarshal(data, (*container)(c))
+}
+
+// MarshalJSON writes containers that only have a name as a plain string
+func (c *Container) MarshalJSON() ([]byte, error) {
+	if reflect.DeepEqual(*c, Container{Name: c.Name}) {
+		return json.Marshal(c.Name)
+	}
+	return json.Marshal((*container)(c))
+}
+
+// engine returns the container engine to run
+func (c *Container) engine() string {
+	if c.Engine == "" {
+		return EngineDocker
+	}
+	return c.Engine
+}
+
+// validate checks the container settings
+func (c *Container) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("no Name given")
+	}
+	switch c.engine() {
+	case EngineDocker, EnginePodman:
+	default:
+		return fmt.Errorf("unknown Engine %q: expected docker or podman", c.Engine)
+	}
+	return nil
+}
+
+// command returns the shell command starting an interactive shell in the
+// container
+func (c *Container) command() string {
+	args := []string{c.engine()}
+	if c.Compose {
+		args = append(args, "compose", "exec")
+	} else {
+		args = append(args, "exec", "-it")
+	}
+	if c.Root != "" {
+		args = append(args, "-w", c.Root)
+	}
+	shell := c.Shell
+	if shell == "" {
+		shell = "sh"
+	}
+	args = append(args, c.Name, shell)
+
+	for i, arg := range args {
+		args[i] = shellQuote(arg)
+	}
+	return strings.Join(args, " ")
+}
+
+// checkEngines makes sure the container engines of the config's local
+// container panes are installed. Remote panes use the host's.
+func (c *Config) checkEngines() error {
+	for _, w := range c.Windows {
+		for idx, p := range w.Panes {
+			if p.Container == nil {
+				continue
+			}
+			if host, _ := w.remote(p); host != "" {
+				continue
+			}
+			if _, err := exec.LookPath(p.Container.engine()); err != nil {
+				return fmt.Errorf("pane %s.%d runs in a %s container, but %s was not found",
+					w.Name, idx, p.Container.engine(), p.Container.engine())
+			}
+		}
+	}
+	return nil
+}
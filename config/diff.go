@@ -0,0 +1,265 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davinche/gmux/command"
+)
+
+// Statuses of windows and panes in a Diff
+const (
+	DiffSame    = "same"    // matches the config
+	DiffChanged = "changed" // exists in both, but differs
+	DiffMissing = "missing" // in the config, but not in the session
+	DiffExtra   = "extra"   // in the session, but not in the config
+)
+
+// Diff describes how a running session differs from its config
+type Diff struct {
+	Session string
+	Running bool
+	Windows []*WindowDiff
+}
+
+// WindowDiff describes how a window differs from its config
+type WindowDiff struct {
+	Name   string
+	Status string
+	Layout *Change `json:",omitempty"`
+	Panes  []*PaneDiff
+}
+
+// PaneDiff describes how a pane differs from its config
+type PaneDiff struct {
+	Index   int
+	Status  string
+	Root    *Change `json:",omitempty"`
+	Command *Change `json:",omitempty"`
+	Host    *Change `json:",omitempty"`
+}
+
+// Change holds a setting as given in the config and as found in the session
+type Change struct {
+	Config string
+	Live   string
+}
+
+// Changed reports whether the session differs from the config in any way
+func (d *Diff) Changed() bool {
+	for _, w := range d.Windows {
+		if w.Status != DiffSame {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff compares the config's running session with the config
+func (c *Config) Diff(ctx context.Context, opts ExecOptions) (*Diff, error) {
+	if c.IsGroup() {
+		return nil, fmt.Errorf("config %q is a group and can not be compared directly", c.Name)
+	}
+	rootAbs, err := c.rootPath()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Diff{Session: c.Name}
+	cc := c.chain(opts)
+	var live []*LiveWindow
+	var shell string
+	if HasSession(ctx, cc, c.Name) {
+		d.Running = true
+		if live, err = Inspect(ctx, cc, c.Name); err != nil {
+			return nil, err
+		}
+		shell = defaultShell(ctx, cc)
+	}
+
+	matched := make(map[*LiveWindow]bool)
+	for _, w := range c.Windows {
+		lw := unmatchedWindow(live, matched, w.Name)
+		if lw != nil {
+			matched[lw] = true
+		}
+		d.Windows = append(d.Windows, c.diffWindow(w, lw, rootAbs, shell))
+	}
+	for _, lw := range live {
+		if matched[lw] {
+			continue
+		}
+		wd := &WindowDiff{Name: lw.Name, Status: DiffExtra}
+		for idx := range lw.Panes {
+			wd.Panes = append(wd.Panes, &PaneDiff{Index: idx, Status: DiffExtra})
+		}
+		d.Windows = append(d.Windows, wd)
+	}
+	return d, nil
+}
+
+// diffWindow compares a window of the config with its live window, if any.
+// shell is the program of panes that aren't running anything.
+func (c *Config) diffWindow(w *Window, lw *LiveWindow, rootAbs, shell string) *WindowDiff {
+	wd := &WindowDiff{Name: w.Name, Status: DiffSame}
+	if lw == nil {
+		wd.Status = DiffMissing
+	}
+
+	// tmux only reports the resulting layout, so only custom layouts
+	// (as printed by `tmux list-windows`) can be compared
+	if lw != nil && strings.Contains(w.Layout, ",") && layoutBody(w.Layout) != layoutBody(lw.Layout) {
+		wd.Status = DiffChanged
+		wd.Layout = &Change{Config: w.Layout, Live: lw.Layout}
+	}
+
+	wRoot := rootAbs
+	if w.Root != "" {
+		wRoot = expandPath(w.Root)
+	}
+
+	for idx := 0; idx < w.paneCount(); idx++ {
+		p := &Pane{}
+		if idx < len(w.Panes) {
+			p = w.Panes[idx]
+		}
+		pd := &PaneDiff{Index: idx, Status: DiffSame}
+		wd.Panes = append(wd.Panes, pd)
+		if lw == nil || idx >= len(lw.Panes) {
+			pd.Status = DiffMissing
+			if wd.Status == DiffSame {
+				wd.Status = DiffChanged
+			}
+			continue
+		}
+
+		// Directories and commands of remote panes are on the host, where
+		// tmux can't see them
+		lp := lw.Panes[idx]
+		host, _ := w.remote(p)
+		if host == "" && filepath.Clean(lp.Path) != filepath.Clean(wRoot) {
+			pd.Root = &Change{Config: wRoot, Live: lp.Path}
+		}
+		if host != lp.Host {
+			pd.Host = &Change{Config: host, Live: lp.Host}
+		}
+
+		// Remote and container panes run ssh or the container engine locally
+		expected := p.lastCommand()
+		if host != "" {
+			expected = "ssh"
+		} else if p.Container != nil {
+			expected = p.Container.engine()
+		}
+		// tmux only knows the program in the foreground of the pane. One
+		// that is back at its shell has finished its command, which is
+		// not a change.
+		if expected != "" && lp.Command != shell && !startedBy(lp.Command, expected) {
+			pd.Command = &Change{Config: expected, Live: lp.Command}
+		}
+		if pd.Root != nil || pd.Command != nil || pd.Host != nil {
+			pd.Status = DiffChanged
+			wd.Status = DiffChanged
+		}
+	}
+	if lw != nil {
+		for idx := w.paneCount(); idx < len(lw.Panes); idx++ {
+			wd.Panes = append(wd.Panes, &PaneDiff{Index: idx, Status: DiffExtra})
+			wd.Status = DiffChanged
+		}
+	}
+	return wd
+}
+
+// Print writes the diff in a human readable form: "+" marks what is missing
+// from the session, "-" what is not in the config, and "~" what differs
+func (d *Diff) Print(out io.Writer) {
+	if !d.Running {
+		fmt.Fprintf(out, "session %s is not running\n", d.Session)
+	}
+	if !d.Changed() {
+		if d.Running {
+			fmt.Fprintf(out, "session %s matches its config\n", d.Session)
+		}
+		return
+	}
+	for _, w := range d.Windows {
+		switch w.Status {
+		case DiffMissing:
+			fmt.Fprintf(out, "+ window %s (%d panes)\n", w.Name, len(w.Panes))
+			continue
+		case DiffExtra:
+			fmt.Fprintf(out, "- window %s (%d panes)\n", w.Name, len(w.Panes))
+			continue
+		case DiffSame:
+			continue
+		}
+
+		fmt.Fprintf(out, "~ window %s\n", w.Name)
+		if w.Layout != nil {
+			fmt.Fprintf(out, "    ~ layout: %s (running: %s)\n", w.Layout.Config, w.Layout.Live)
+		}
+		for _, p := range w.Panes {
+			switch p.Status {
+			case DiffMissing:
+				fmt.Fprintf(out, "    + pane %d\n", p.Index)
+			case DiffExtra:
+				fmt.Fprintf(out, "    - pane %d\n", p.Index)
+			case DiffChanged:
+				if p.Root != nil {
+					fmt.Fprintf(out, "    ~ pane %d root: %s (running: %s)\n", p.Index, p.Root.Config, p.Root.Live)
+				}
+				if p.Command != nil {
+					fmt.Fprintf(out, "    ~ pane %d command: %s (running: %s)\n", p.Index, p.Command.Config, p.Command.Live)
+				}
+				if p.Host != nil {
+					fmt.Fprintf(out, "    ~ pane %d host: %s (running: %s)\n", p.Index, hostName(p.Host.Config), hostName(p.Host.Live))
+				}
+			}
+		}
+	}
+}
+
+// hostName describes where a pane runs
+func hostName(host string) string {
+	if host == "" {
+		return "local"
+	}
+	return host
+}
+
+// startedBy reports whether program, the command tmux reports for a pane,
+// may have been started by the shell command cmd: it is either the program
+// cmd runs or one named in its arguments, as with "env PORT=80 node app.js".
+// Programs started through wrappers under another name, such as ruby for
+// "bundle exec rails server", don't match.
+func startedBy(program, cmd string) bool {
+	for _, field := range strings.Fields(cmd) {
+		if filepath.Base(field) == program {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultShell returns the name of the shell tmux starts panes with, which is
+// what it reports as the command of a pane that runs nothing else
+func defaultShell(ctx context.Context, cc *command.Chain) string {
+	shell, err := cc.Output(ctx, "tmux", "show-options", "-gv", "default-shell")
+	if err != nil || shell == "" {
+		shell = os.Getenv("SHELL")
+	}
+	return filepath.Base(shell)
+}
+
+// layoutBody strips the checksum from a custom layout string
+func layoutBody(layout string) string {
+	if i := strings.Index(layout, ","); i != -1 {
+		return layout[i+1:]
+	}
+	return layout
+}
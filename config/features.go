@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/davinche/gmux/command"
+)
+
+// feature is a tmux capability that is only available from a certain version
+type feature struct {
+	Name  string
+	Major int
+	Minor int
+}
+
+// Known features used by gmux and the tmux version that introduced them
+var (
+	featureStartDirectory = feature{"window and pane start directories (-c)", 1, 9}
+	featureWaitFor        = feature{"pane dependencies (wait-for)", 1, 8}
+	featurePaneTitle      = feature{"pane titles (select-pane -T)", 2, 6}
+	featurePaneBorder     = feature{"pane border labels (pane-border-status)", 2, 3}
+	featureMainPaneSize   = feature{"percentage main pane sizes", 3, 1}
+	featureBindings       = feature{"session key bindings (if-shell -F with #{==:})", 2, 4}
+
+	// not required by any config, only used when available
+	featureDefaultSize = feature{"default-size", 2, 9}
+	featureSessionEnv  = feature{"new-session -e", 3, 2}
+)
+
+// supportedBy reports whether the given tmux version has the feature
+func (f feature) supportedBy(v command.Version) bool {
+	return v.AtLeast(f.Major, f.Minor)
+}
+
+// features lists the tmux features needed to run the config
+func (c *Config) features() []feature {
+	features := []feature{featureStartDirectory}
+	if c.PaneBorderStatus != "" {
+		features = append(features, featurePaneBorder)
+	}
+	var waitFor, title, percent bool
+	for _, w := range c.Windows {
+		percent = percent || w.MainPaneWidth.percent() || w.MainPaneHeight.percent()
+		for _, p := range w.Panes {
+			waitFor = waitFor || len(p.DependsOn) > 0
+			title = title || p.Title != ""
+		}
+	}
+	if waitFor {
+		features = append(features, featureWaitFor)
+	}
+	if title {
+		features = append(features, featurePaneTitle)
+	}
+	if percent {
+		features = append(features, featureMainPaneSize)
+	}
+	if len(c.Bindings) > 0 {
+		features = append(features, featureBindings)
+	}
+	return features
+}
+
+// checkFeatures makes sure the installed tmux supports everything the config uses
+func (c *Config) checkFeatures(v command.Version) error {
+	for _, f := range c.features() {
+		if !f.supportedBy(v) {
+			return fmt.Errorf("config %q uses %s, which requires tmux %d.%d or newer (found tmux %s)",
+				c.Name, f.Name, f.Major, f.Minor, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davinche/gmux/command"
+)
+
+// LiveWindow describes a window of a running tmux session
+type LiveWindow struct {
+	ID     string
+	Name   string
+	Layout string
+	Panes  []*LivePane
+}
+
+// LivePane describes a pane of a running tmux session
+type LivePane struct {
+	ID      string
+	Path    string // current working directory
+	Command string // command currently running in the pane
+
+	// Host is the host the pane is connected to, for remote panes started
+	// by gmux
+	Host string `json:",omitempty"`
+}
+
+// LiveSession describes a running tmux session
+type LiveSession struct {
+	Name    string
+	Config  string // the gmux config the session was started from, if any
+	Windows []string
+	Clients int // number of attached clients
+	Created time.Time
+
+	// Socket is the socket of the server the session runs on, when it is
+	// one of a config's rather than the one gmux was asked to use
+	Socket string `json:",omitempty"`
+
+	// Tmux is how to reach the server the session runs on
+	Tmux command.Tmux `json:"-"`
+}
+
+// sessionConfigOption is the session user option holding the name of the
+// gmux config a session was started from
+const sessionConfigOption = "@gmux_config"
+
+// separates the fields printed by tmux (tabs would be escaped by tmux)
+const fieldSep = "|:|"
+
+// paneFormat lists one pane per line along with its window
+var paneFormat = strings.Join([]string{
+	"#{window_id}",
+	"#{window_name}",
+	"#{window_layout}",
+	"#{pane_id}",
+	"#{pane_current_path}",
+	"#{pane_current_command}",
+	"#{pane_start_command}",
+}, fieldSep)
+
+// Inspect queries tmux for the windows and panes of a running session
+func Inspect(ctx context.Context, cc *command.Chain, session string) ([]*LiveWindow, error) {
+	out, err := cc.Output(ctx, "tmux", "list-panes", "-s", "-t", "="+session, "-F", paneFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	var windows []*LiveWindow
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, fieldSep)
+		if len(fields) != 7 {
+			continue
+		}
+		if len(windows) == 0 || windows[len(windows)-1].ID != fields[0] {
+			windows = append(windows, &LiveWindow{
+				ID:     fields[0],
+				Name:   fields[1],
+				Layout: fields[2],
+			})
+		}
+		w := windows[len(windows)-1]
+		w.Panes = append(w.Panes, &LivePane{
+			ID:      fields[3],
+			Path:    fields[4],
+			Command: fields[5],
+			Host:    sshHost(fields[6]),
+		})
+	}
+	return windows, nil
+}
+
+// sessionFormat lists one session per line
+var sessionFormat = strings.Join([]string{
+	"#{session_name}",
+	"#{" + sessionConfigOption + "}",
+	"#{session_attached}",
+	"#{session_created}",
+}, fieldSep)
+
+// windowFormat lists one window per line along with its session
+var windowFormat = strings.Join([]string{
+	"#{session_name}",
+	"#{window_name}",
+}, fieldSep)
+
+// ListSessions queries tmux for every running session
+func ListSessions(ctx context.Context, cc *command.Chain) ([]*LiveSession, error) {
+	out, err := cc.Output(ctx, "tmux", "list-sessions", "-F", sessionFormat)
+	if err != nil {
+		// A server without sessions exits right away
+		if NoServer(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var sessions []*LiveSession
+	byName := make(map[string]*LiveSession)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, fieldSep)
+		if len(fields) != 4 {
+			continue
+		}
+		s := &LiveSession{Name: fields[0], Config: fields[1], Tmux: cc.Tmux}
+		s.Clients, _ = strconv.Atoi(fields[2])
+		if created, err := strconv.ParseInt(fields[3], 10, 64); err == nil {
+			s.Created = time.Unix(created, 0)
+		}
+		sessions = append(sessions, s)
+		byName[s.Name] = s
+	}
+
+	out, err = cc.Output(ctx, "tmux", "list-windows", "-a", "-F", windowFormat)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, fieldSep)
+		if len(fields) != 2 {
+			continue
+		}
+		if s, ok := byName[fields[0]]; ok {
+			s.Windows = append(s.Windows, fields[1])
+		}
+	}
+	return sessions, nil
+}
+
+// HasSession reports whether a session with exactly the given name is running
+// (tmux would otherwise also match sessions starting with the name)
+func HasSession(ctx context.Context, cc *command.Chain, name string) bool {
+	_, err := cc.Output(ctx, "tmux", "has-session", "-t", "="+name)
+	return err == nil
+}
+
+// NoServer reports whether a tmux command failed because no server is
+// running on its socket
+func NoServer(err error) bool {
+	return strings.Contains(err.Error(), "no server running") || strings.Contains(err.Error(), "error connecting")
+}
+
+// socketName returns the socket a server is reached through, "" for the
+// default one
+func socketName(t command.Tmux) string {
+	if t.SocketPath != "" {
+		return t.SocketPath
+	}
+	return t.Socket
+}
+
+// Servers returns how to reach every tmux server gmux sessions may run on:
+// the one base selects and those of configs with their own socket
+func Servers(base command.Tmux) []command.Tmux {
+	servers := []command.Tmux{base}
+	seen := map[string]bool{socketName(base): true}
+	names, _ := Names()
+	for _, name := range names {
+		c, err := Get(name)
+		if err != nil {
+			continue
+		}
+		t := c.Tmux(base)
+		if !seen[socketName(t)] {
+			seen[socketName(t)] = true
+			servers = append(servers, t)
+		}
+	}
+	return servers
+}
+
+// ListAllSessions queries every server gmux sessions may run on for its
+// sessions, starting with the chain's own. Servers of configs that can't be
+// reached are skipped.
+func ListAllSessions(ctx context.Context, cc *command.Chain) ([]*LiveSession, error) {
+	var all []*LiveSession
+	for idx, t := range Servers(cc.Tmux) {
+		sc := cc.Clone()
+		sc.Tmux = t
+		sessions, err := ListSessions(ctx, sc)
+		if err != nil {
+			if idx == 0 || ctx.Err() != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, s := range sessions {
+			if idx > 0 {
+				s.Socket = socketName(t)
+			}
+		}
+		all = append(all, sessions...)
+	}
+	return all, nil
+}
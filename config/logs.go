@@ -0,0 +1,213 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultLogMaxSize is the size at which pane logs are rotated when the
+// config doesn't set LogMaxSize
+const defaultLogMaxSize = 10 << 20
+
+// logPollInterval is how often followed logs are checked for new output
+const logPollInterval = 250 * time.Millisecond
+
+// logged reports whether the output of a pane of the window is logged
+func (w *Window) logged(p *Pane) bool {
+	return w.Log || p != nil && p.Log
+}
+
+// startCommand returns the arguments to create the window's pane at idx with.
+// Logged remote and container panes start with a plain shell instead of
+// paneCommand, so that their output is piped to the log before their command
+// runs; the builder respawns them with it then.
+func (w *Window) startCommand(idx int) []string {
+	if idx < len(w.Panes) && w.logged(w.Panes[idx]) {
+		return nil
+	}
+	return w.paneCommand(idx)
+}
+
+// logDir returns the directory holding the session's pane logs
+func (c *Config) logDir() string {
+	dir := path.Join(configDir, "logs")
+	if c.LogDir != "" {
+		dir = expandPath(c.LogDir)
+	}
+	return filepath.Join(dir, c.Name)
+}
+
+// logFile returns the log file of the pane at pIdx of the window at wIdx
+func (c *Config) logFile(wIdx, pIdx int) string {
+	name := strings.ReplaceAll(c.Windows[wIdx].Name, "/", "_")
+	return filepath.Join(c.logDir(), fmt.Sprintf("%s.%d.log", name, pIdx))
+}
+
+// LogFile returns the log file of a pane, given by its name or as "window"
+// or "window.pane"
+func (c *Config) LogFile(ref string) (string, error) {
+	wIdx, pIdx, err := c.findPane(ref)
+	if err != nil {
+		return "", err
+	}
+	w := c.Windows[wIdx]
+	var p *Pane
+	if pIdx < len(w.Panes) {
+		p = w.Panes[pIdx]
+	}
+	if !w.logged(p) {
+		return "", fmt.Errorf("pane %s.%d is not logged", w.Name, pIdx)
+	}
+	return c.logFile(wIdx, pIdx), nil
+}
+
+// pipeCommand returns the pipe-pane command writing a pane's output to file
+// through the hidden `gmux log-pipe` command, which rotates the file
+func (c *Config) pipeCommand(file string) (string, error) {
+	gmux, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("could not find the gmux executable to log panes with: %s", err)
+	}
+	maxSize, _ := parseByteSize(c.LogMaxSize, defaultLogMaxSize)
+	cmd := strings.Join([]string{"exec", shellQuote(gmux), "log-pipe",
+		"--max-size", strconv.FormatInt(maxSize, 10), shellQuote(file)}, " ")
+	return escapeFormat(cmd), nil
+}
+
+// parseByteSize parses an optional size such as "512K", "10M" or "1G",
+// falling back to def when empty
+func parseByteSize(s string, def int64) (int64, error) {
+	if s == "" {
+		return def, nil
+	}
+	number, unit := s, int64(1)
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		unit = 1 << 10
+	case "M":
+		unit = 1 << 20
+	case "G":
+		unit = 1 << 30
+	}
+	if unit != 1 {
+		number = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q: expected a number of bytes, optionally with a K, M or G suffix", s)
+	}
+	return n * unit, nil
+}
+
+// WriteLog appends everything read from r to file. Once the file would grow
+// beyond maxSize, it is moved to file.1, replacing any previous one, and a
+// new file is started.
+func WriteLog(r io.Reader, file string, maxSize int64) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+	fInfo, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := fInfo.Size()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			if maxSize > 0 && size > 0 && size+int64(n) > maxSize {
+				f.Close()
+				if err := os.Rename(file, file+".1"); err != nil {
+					return err
+				}
+				if f, err = os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644); err != nil {
+					return err
+				}
+				size = 0
+			}
+			if _, err := f.Write(buf[:n]); err != nil {
+				return err
+			}
+			size += int64(n)
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// DumpLog writes the rotated log, if any, and the current log to out
+func DumpLog(out io.Writer, file string) error {
+	found := false
+	for _, name := range []string{file + ".1", file} {
+		f, err := os.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+		_, err = io.Copy(out, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if !found {
+		return fmt.Errorf("no log found at %s", file)
+	}
+	return nil
+}
+
+// FollowLog writes the current log to out and then keeps writing whatever is
+// added to it, following it across rotations, until the context is done
+func FollowLog(ctx context.Context, out io.Writer, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+
+	ticker := time.NewTicker(logPollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := io.Copy(out, f); err != nil {
+			return err
+		}
+
+		// After a rotation, the file at the path is a new one. What was
+		// written to the old one has been copied above.
+		if current, err := os.Stat(file); err == nil {
+			if opened, err := f.Stat(); err == nil && !os.SameFile(current, opened) {
+				f.Close()
+				if f, err = os.Open(file); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
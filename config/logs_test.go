@@ -0,0 +1,158 @@
+package config
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		err  bool
+	}{
+		{in: "", want: defaultLogMaxSize},
+		{in: "512", want: 512},
+		{in: "512K", want: 512 << 10},
+		{in: "10M", want: 10 << 20},
+		{in: "10m", want: 10 << 20},
+		{in: "1G", want: 1 << 30},
+		{in: "0", err: true},
+		{in: "-1M", err: true},
+		{in: "M", err: true},
+		{in: "1.5M", err: true},
+		{in: "10MB", err: true},
+		{in: "ten", err: true},
+	}
+
+	for _, test := range tests {
+		got, err := parseByteSize(test.in, defaultLogMaxSize)
+		if test.err {
+			if err == nil {
+				t.Errorf("parseByteSize(%q) = %d, expected an error", test.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseByteSize(%q): unexpected error: %s", test.in, err)
+		} else if got != test.want {
+			t.Errorf("parseByteSize(%q) = %d, expected %d", test.in, got, test.want)
+		}
+	}
+}
+
+func TestWriteLog(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string // content of the log before writing, if any
+		input    string
+		maxSize  int64
+		current  string
+		rotated  string // content of file.1, "" if there is none
+	}{
+		{
+			name:    "new file",
+			input:   "hello\n",
+			maxSize: 100,
+			current: "hello\n",
+		},
+		{
+			name:     "appends",
+			existing: "one\n",
+			input:    "two\n",
+			maxSize:  100,
+			current:  "one\ntwo\n",
+		},
+		{
+			name:    "rotates when full",
+			input:   "aaaa\nbbbb\ncccc\n",
+			maxSize: 10,
+			current: "cccc\n",
+			rotated: "aaaa\nbbbb\n",
+		},
+		{
+			name:     "rotates an existing file",
+			existing: "12345678\n",
+			input:    "next\n",
+			maxSize:  10,
+			current:  "next\n",
+			rotated:  "12345678\n",
+		},
+		{
+			name:    "no limit",
+			input:   strings.Repeat("x", 100),
+			current: strings.Repeat("x", 100),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gmux-logs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			// The directory is created as needed
+			file := filepath.Join(dir, "session", "w.0.log")
+			if test.existing != "" {
+				if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(file, []byte(test.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Read a line at a time, the way output arrives from a pane
+			r := iotest.OneByteReader(strings.NewReader(test.input))
+			if strings.Contains(test.input, "\n") {
+				r = &lineReader{lines: strings.SplitAfter(test.input, "\n")}
+			}
+			if err := WriteLog(r, file, test.maxSize); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if got := readFile(t, file); got != test.current {
+				t.Errorf("log contains %q, expected %q", got, test.current)
+			}
+			if got := readFile(t, file+".1"); got != test.rotated {
+				t.Errorf("rotated log contains %q, expected %q", got, test.rotated)
+			}
+		})
+	}
+}
+
+// lineReader returns one line per Read
+type lineReader struct {
+	lines []string
+}
+
+func (r *lineReader) Read(p []byte) (int, error) {
+	for len(r.lines) > 0 && r.lines[0] == "" {
+		r.lines = r.lines[1:]
+	}
+	if len(r.lines) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.lines[0])
+	r.lines[0] = r.lines[0][n:]
+	return n, nil
+}
+
+// readFile returns the content of the file, or "" if it doesn't exist
+func readFile(t *testing.T, file string) string {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
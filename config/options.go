@@ -0,0 +1,157 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Options are tmux options set on a session or window. Values may be strings,
+// numbers or booleans, which are set as "on" or "off".
+type Options map[string]interface{}
+
+// optionKind is the type of value a tmux option takes
+type optionKind int
+
+const (
+	optionString optionKind = iota
+	optionFlag
+	optionNumber
+	optionChoice
+)
+
+// optionType describes a known tmux option
+type optionType struct {
+	window  bool // a window option rather than a session option
+	kind    optionKind
+	choices []string
+}
+
+// Commonly used tmux options and the values they take. Options that aren't
+// listed here (including user options starting with @) are passed to tmux
+// unchecked.
+var knownOptions = map[string]optionType{
+	// session options
+	"base-index":         {kind: optionNumber},
+	"default-command":    {kind: optionString},
+	"default-shell":      {kind: optionString},
+	"destroy-unattached": {kind: optionFlag},
+	"detach-on-destroy":  {kind: optionChoice, choices: []string{"on", "off", "no-detached", "previous", "next"}},
+	"display-time":       {kind: optionNumber},
+	"history-limit":      {kind: optionNumber},
+	"mouse":              {kind: optionFlag},
+	"prefix":             {kind: optionString},
+	"renumber-windows":   {kind: optionFlag},
+	"set-titles":         {kind: optionFlag},
+	"status":             {kind: optionChoice, choices: []string{"on", "off", "2", "3", "4", "5"}},
+	"status-interval":    {kind: optionNumber},
+	"status-justify":     {kind: optionChoice, choices: []string{"left", "centre", "right", "absolute-centre"}},
+	"status-keys":        {kind: optionChoice, choices: []string{"vi", "emacs"}},
+	"status-left":        {kind: optionString},
+	"status-position":    {kind: optionChoice, choices: []string{"top", "bottom"}},
+	"status-right":       {kind: optionString},
+	"status-style":       {kind: optionString},
+	"visual-activity":    {kind: optionChoice, choices: []string{"on", "off", "both"}},
+	"visual-bell":        {kind: optionChoice, choices: []string{"on", "off", "both"}},
+
+	// window options
+	"aggressive-resize":   {window: true, kind: optionFlag},
+	"allow-rename":        {window: true, kind: optionFlag},
+	"automatic-rename":    {window: true, kind: optionFlag},
+	"main-pane-height":    {window: true, kind: optionString},
+	"main-pane-width":     {window: true, kind: optionString},
+	"mode-keys":           {window: true, kind: optionChoice, choices: []string{"vi", "emacs"}},
+	"monitor-activity":    {window: true, kind: optionFlag},
+	"monitor-bell":        {window: true, kind: optionFlag},
+	"monitor-silence":     {window: true, kind: optionNumber},
+	"pane-base-index":     {window: true, kind: optionNumber},
+	"pane-border-format":  {window: true, kind: optionString},
+	"pane-border-status":  {window: true, kind: optionChoice, choices: []string{"off", "top", "bottom"}},
+	"remain-on-exit":      {window: true, kind: optionChoice, choices: []string{"on", "off", "failed"}},
+	"synchronize-panes":   {window: true, kind: optionFlag},
+	"window-status-style": {window: true, kind: optionString},
+}
+
+// option is a single option name and its value as passed to tmux
+type option struct {
+	name  string
+	value string
+}
+
+// list returns the options sorted by name with their values converted for
+// tmux. window tells whether the options are set on a window, so that known
+// options of the other kind can be rejected.
+func (o Options) list(window bool) ([]option, error) {
+	names := make([]string, 0, len(o))
+	for name := range o {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	options := make([]option, 0, len(o))
+	for _, name := range names {
+		value, err := optionValue(o[name])
+		if err != nil {
+			return nil, fmt.Errorf("option %q: %s", name, err)
+		}
+		if t, ok := knownOptions[name]; ok {
+			if t.window && !window {
+				return nil, fmt.Errorf("option %q is a window option, set it in the windows' Options", name)
+			}
+			if !t.window && window {
+				return nil, fmt.Errorf("option %q is a session option, set it in the config's Options", name)
+			}
+			if err := t.check(value); err != nil {
+				return nil, fmt.Errorf("option %q: %s", name, err)
+			}
+		}
+		options = append(options, option{name: name, value: value})
+	}
+	return options, nil
+}
+
+// optionValue converts a value from the config file to the form tmux expects
+func optionValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		if v {
+			return "on", nil
+		}
+		return "off", nil
+	case float64:
+		if v == math.Trunc(v) {
+			return strconv.FormatInt(int64(v), 10), nil
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("value must be a string, number or boolean")
+	}
+}
+
+// check makes sure the value suits the option
+func (t optionType) check(value string) error {
+	switch t.kind {
+	case optionFlag:
+		switch value {
+		case "on", "off", "yes", "no", "1", "0":
+			return nil
+		}
+		return fmt.Errorf("expected on or off, got %q", value)
+	case optionNumber:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("expected a number, got %q", value)
+		}
+	case optionChoice:
+		for _, choice := range t.choices {
+			if value == choice {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected one of %s, got %q", strings.Join(t.choices, ", "), value)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOptionsList(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		window  bool
+		want    []option
+		err     string // expected error substring, "" for none
+	}{
+		{
+			name:    "sorted and converted",
+			options: Options{"mouse": true, "history-limit": float64(5000), "status-left": "#S", "@custom": false},
+			want: []option{
+				{name: "@custom", value: "off"},
+				{name: "history-limit", value: "5000"},
+				{name: "mouse", value: "on"},
+				{name: "status-left", value: "#S"},
+			},
+		},
+		{
+			name:    "window options",
+			options: Options{"synchronize-panes": "on", "pane-border-status": "top"},
+			window:  true,
+			want: []option{
+				{name: "pane-border-status", value: "top"},
+				{name: "synchronize-panes", value: "on"},
+			},
+		},
+		{
+			name:    "unknown options are unchecked",
+			options: Options{"some-new-option": float64(1.5)},
+			want:    []option{{name: "some-new-option", value: "1.5"}},
+		},
+		{
+			name:    "window option on the session",
+			options: Options{"mode-keys": "vi"},
+			err:     "is a window option",
+		},
+		{
+			name:    "session option on a window",
+			options: Options{"mouse": true},
+			window:  true,
+			err:     "is a session option",
+		},
+		{
+			name:    "unsupported value",
+			options: Options{"status-left": []interface{}{"a"}},
+			err:     "must be a string, number or boolean",
+		},
+		{
+			name:    "invalid value",
+			options: Options{"status-position": "middle"},
+			err:     `option "status-position": expected one of top, bottom`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.options.list(test.window)
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("unexpected error: %s", err)
+			case test.err != "" && err == nil:
+				t.Fatalf("expected an error containing %q", test.err)
+			case test.err != "" && !strings.Contains(err.Error(), test.err):
+				t.Fatalf("expected an error containing %q, got %q", test.err, err)
+			}
+			if test.err == "" && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("list() = %v, expected %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestOptionTypeCheck(t *testing.T) {
+	tests := []struct {
+		option string
+		value  string
+		ok     bool
+	}{
+		{"mouse", "on", true},
+		{"mouse", "no", true},
+		{"mouse", "maybe", false},
+		{"history-limit", "5000", true},
+		{"history-limit", "lots", false},
+		{"history-limit", "1.5", false},
+		{"status", "2", true},
+		{"status", "6", false},
+		{"detach-on-destroy", "previous", true},
+		{"detach-on-destroy", "Previous", false},
+		{"status-left", "anything", true},
+	}
+	for _, test := range tests {
+		if err := knownOptions[test.option].check(test.value); (err == nil) != test.ok {
+			t.Errorf("check of %s %q = %v, expected ok = %t", test.option, test.value, err, test.ok)
+		}
+	}
+}
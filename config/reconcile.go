@@ -0,0 +1,97 @@
+package config
+
+import (
+	"context"
+	"fmt"
+)
+
+// Reconcile compares the config's running session with the config and creates
+// the windows and panes that are missing, matching windows by name. Panes that
+// are already running are never touched. With prune, windows and panes that
+// are not in the config are removed. Reconcile returns a description of every
+// change made, once all of the tmux commands making them have run. On error,
+// no changes are reported, even though some may have been made.
+func (c *Config) Reconcile(ctx context.Context, opts ExecOptions, prune bool) ([]string, error) {
+	if c.IsGroup() {
+		return nil, fmt.Errorf("config %q is a group and can not be reconciled directly", c.Name)
+	}
+	cc := c.chain(opts)
+	if err := c.checkFeatures(c.tmuxVersion(ctx, cc, opts)); err != nil {
+		return nil, err
+	}
+	if err := c.checkEngines(); err != nil {
+		return nil, err
+	}
+	rootAbs, err := c.rootPath()
+	if err != nil {
+		return nil, err
+	}
+
+	live, err := Inspect(ctx, cc, c.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []string
+	b := newBuilder(c, cc, rootAbs)
+	matched := make(map[*LiveWindow]bool)
+	for idx, w := range c.Windows {
+		lw := unmatchedWindow(live, matched, w.Name)
+		if lw == nil {
+			if err := b.addWindow(ctx, idx); err != nil {
+				return nil, err
+			}
+			changes = append(changes, fmt.Sprintf("created window %s", w.Name))
+			continue
+		}
+		matched[lw] = true
+
+		b.windowIDs[idx] = lw.ID
+		for _, p := range lw.Panes {
+			b.paneIDs[idx] = append(b.paneIDs[idx], p.ID)
+		}
+
+		want := w.paneCount()
+		have := len(lw.Panes)
+		switch {
+		case have < want:
+			if err := b.addPanes(ctx, idx, have); err != nil {
+				return nil, err
+			}
+			b.layout(idx)
+			changes = append(changes, fmt.Sprintf("added %d pane(s) to window %s", want-have, w.Name))
+		case have > want && prune:
+			for _, p := range lw.Panes[want:] {
+				cc.Add("tmux", "kill-pane", "-t", p.ID)
+			}
+			b.paneIDs[idx] = b.paneIDs[idx][:want]
+			b.layout(idx)
+			changes = append(changes, fmt.Sprintf("removed %d pane(s) from window %s", have-want, w.Name))
+		}
+	}
+
+	if prune {
+		for _, lw := range live {
+			if !matched[lw] {
+				cc.Add("tmux", "kill-window", "-t", lw.ID)
+				changes = append(changes, fmt.Sprintf("removed window %s", lw.Name))
+			}
+		}
+	}
+
+	if err := b.run(ctx); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// unmatchedWindow finds the first live window with the given name that has not
+// been matched to a window of the config yet
+func unmatchedWindow(live []*LiveWindow, matched map[*LiveWindow]bool, name string) *LiveWindow {
+	for _, lw := range live {
+		if lw.Name == name && !matched[lw] {
+			return lw
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"strings"
+)
+
+// remote returns the host a pane of the window runs on over ssh and the
+// directory to start in there. The pane's settings take precedence over the
+// window's.
+func (w *Window) remote(p *Pane) (string, string) {
+	host, root := w.Host, w.RemoteRoot
+	if p != nil && p.Host != "" {
+		host, root = p.Host, p.RemoteRoot
+	}
+	if p != nil && p.RemoteRoot != "" {
+		root = p.RemoteRoot
+	}
+	return host, root
+}
+
+// wrapped reports whether a pane of the window runs somewhere else than in
+// a local shell, i.e. on another host or in a container
+func (w *Window) wrapped(p *Pane) bool {
+	host, _ := w.remote(p)
+	return host != "" || p != nil && p.Container != nil
+}
+
+// paneCommand returns the arguments to append to new-session, new-window or
+// split-window when creating the window's pane at idx, which start a shell
+// on the pane's host or in its container
+func (w *Window) paneCommand(idx int) []string {
+	var p *Pane
+	if idx < len(w.Panes) {
+		p = w.Panes[idx]
+	}
+	var inner string
+	if p != nil && p.Container != nil {
+		inner = p.Container.command()
+	}
+	host, root := w.remote(p)
+	if host != "" {
+		return []string{sshCommand(host, root, inner)}
+	}
+	if inner != "" {
+		return []string{inner}
+	}
+	return nil
+}
+
+// sshCommand returns the shell command connecting a pane to the host and
+// running inner there, or a login shell if inner is empty. Either is started
+// in root, if given.
+func sshCommand(host, root, inner string) string {
+	cmd := "ssh -t " + shellQuote(host)
+	if inner == "" && root == "" {
+		return cmd
+	}
+	if inner == "" {
+		inner = `"$SHELL" -l`
+	}
+	remote := "exec " + inner
+	if root != "" {
+		remote = "cd " + remotePath(root) + " && " + remote
+	}
+	return cmd + " " + shellQuote(remote)
+}
+
+// sshHost returns the host of a pane started with sshCommand, given the
+// pane's start command as reported by tmux, or "" for other panes
+func sshHost(startCommand string) string {
+	fields := strings.Fields(strings.Trim(startCommand, `"`))
+	if len(fields) < 3 || fields[0] != "ssh" || fields[1] != "-t" {
+		return ""
+	}
+	return strings.Trim(fields[2], "'")
+}
+
+// remotePath quotes a directory for the remote shell, leaving a leading ~
+// for it to expand
+func remotePath(p string) string {
+	if p == "~" {
+		return p
+	}
+	if strings.HasPrefix(p, "~/") {
+		return "~/" + shellQuote(p[2:])
+	}
+	return shellQuote(p)
+}
+
+// shellQuote quotes s as a single shell word, unless it is made of
+// characters that need no quoting
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%-_.,/:=+") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
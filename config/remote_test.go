@@ -0,0 +1,117 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"user@host.example.com:22", "user@host.example.com:22"},
+		{"-t", "-t"},
+		{"", "''"},
+		{"two words", "'two words'"},
+		{"it's", `'it'\''s'`},
+		{"$HOME", "'$HOME'"},
+		{"a;b", "'a;b'"},
+		{`"quoted"`, `'"quoted"'`},
+	}
+	for _, test := range tests {
+		if got := shellQuote(test.in); got != test.want {
+			t.Errorf("shellQuote(%q) = %s, expected %s", test.in, got, test.want)
+		}
+	}
+}
+
+func TestSSHCommand(t *testing.T) {
+	tests := []struct {
+		host, root, inner string
+		want              string
+	}{
+		{"dev", "", "", "ssh -t dev"},
+		{"user@dev", "/srv/app", "", `ssh -t user@dev 'cd /srv/app && exec "$SHELL" -l'`},
+		{"dev", "~/app", "", `ssh -t dev 'cd ~/app && exec "$SHELL" -l'`},
+		{"dev", "~/my app", "", `ssh -t dev 'cd ~/'\''my app'\'' && exec "$SHELL" -l'`},
+		{"dev", "", "docker exec -it web sh", `ssh -t dev 'exec docker exec -it web sh'`},
+		{"dev box", "", "", "ssh -t 'dev box'"},
+	}
+	for _, test := range tests {
+		if got := sshCommand(test.host, test.root, test.inner); got != test.want {
+			t.Errorf("sshCommand(%q, %q, %q) = %s, expected %s", test.host, test.root, test.inner, got, test.want)
+		}
+	}
+}
+
+func TestSSHHost(t *testing.T) {
+	tests := []struct {
+		startCommand, want string
+	}{
+		// tmux reports start commands quoted
+		{`"ssh -t dev"`, "dev"},
+		{`"ssh -t user@dev 'cd /srv && exec \"$SHELL\" -l'"`, "user@dev"},
+		{"ssh -t dev", "dev"},
+		{"", ""},
+		{`"docker exec -it web sh"`, ""},
+		{`"ssh dev"`, ""},
+	}
+	for _, test := range tests {
+		if got := sshHost(test.startCommand); got != test.want {
+			t.Errorf("sshHost(%q) = %q, expected %q", test.startCommand, got, test.want)
+		}
+	}
+}
+
+// TestSSHCommandStub runs pane commands against a stub ssh that prints its
+// arguments, then runs the remote command it was given in a local shell
+func TestSSHCommandStub(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh to run commands with")
+	}
+	dir, err := ioutil.TempDir("", "gmux-ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stub := "#!/bin/sh\nfor arg in \"$@\"; do printf '%s\\n' \"$arg\"; done\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "ssh"), []byte(stub), 0755); err != nil {
+		t.Fatal(err)
+	}
+	home := filepath.Join(dir, "home")
+	if err := os.MkdirAll(filepath.Join(home, "it's here"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	env := append(os.Environ(), "PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"), "HOME="+home)
+
+	w := &Window{Host: "user@dev", RemoteRoot: "~/it's here", Panes: []*Pane{{}}}
+	cmd := exec.Command(sh, "-c", w.paneCommand(0)[0])
+	cmd.Env = env
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("running the pane command: %s", err)
+	}
+	args := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if len(args) != 3 || !reflect.DeepEqual(args[:2], []string{"-t", "user@dev"}) {
+		t.Fatalf("ssh was run with %q", args)
+	}
+
+	// The remote shell would start a login shell; print its directory instead
+	remote := strings.Replace(args[2], `"$SHELL" -l`, "pwd", 1)
+	cmd = exec.Command(sh, "-c", remote)
+	cmd.Env = env
+	out, err = cmd.Output()
+	if err != nil {
+		t.Fatalf("running the remote command %q: %s", args[2], err)
+	}
+	if got, want := strings.TrimSpace(string(out)), filepath.Join(home, "it's here"); got != want {
+		t.Errorf("remote command started in %q, expected %q", got, want)
+	}
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/davinche/gmux/command"
+)
+
+// scheduledPane is a pane whose command cannot simply be sent right away
+// because it waits for a condition or other panes, because other panes wait
+// for it to become ready, or because its steps are delayed
+type scheduledPane struct {
+	label string // the pane's Name, or "window.pane"
+	id    string // tmux pane ID
+
+	// tmux IDs of the panes referenced by WaitFor.Pane and Ready.Pane
+	waitTarget  string
+	readyTarget string
+
+	pane *Pane
+}
+
+// scheduled reports whether a pane has to go through the scheduler
+func (c *Config) scheduled(p *Pane) bool {
+	return p.WaitFor != nil || len(p.DependsOn) > 0 || c.dependedOn(p.Name) || p.delayed()
+}
+
+// dependedOn reports whether any pane depends on the named pane
+func (c *Config) dependedOn(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, w := range c.Windows {
+		for _, p := range w.Panes {
+			for _, dep := range p.DependsOn {
+				if dep == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// readyChannel is the tmux wait-for channel signalled once the named pane is
+// ready. Pane commands may signal it themselves with `tmux wait-for -S`.
+func (c *Config) readyChannel(name string) string {
+	return fmt.Sprintf("gmux-%s-%s", c.Name, name)
+}
+
+// runScheduled starts all scheduled panes concurrently. A pane waits until
+// every pane it depends on has signalled its ready channel and its WaitFor
+// conditions hold, then its command is sent. If other panes depend on it, it
+// signals its own ready channel once its Ready conditions hold. The first
+// failure cancels everything else.
+func (c *Config) runScheduled(ctx context.Context, cc *command.Chain, panes []scheduledPane) error {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*len(panes))
+	fail := func(err error) {
+		errs <- err
+		cancel()
+	}
+
+	// A single relay per channel waits for the tmux signal, so that any
+	// number of dependents can be released without racing on the channel
+	ready := make(map[string]chan struct{})
+	for _, p := range panes {
+		if !c.dependedOn(p.pane.Name) {
+			continue
+		}
+		released := make(chan struct{})
+		ready[p.pane.Name] = released
+
+		wg.Add(1)
+		go func(channel string) {
+			defer wg.Done()
+			// No per-command timeout: this blocks until the pane is ready
+			wc := cc.Clone()
+			wc.Timeout = 0
+			wc.Add("tmux", "wait-for", channel)
+			if err := wc.Run(ctx); err != nil {
+				if ctx.Err() == nil {
+					fail(err)
+				}
+				return
+			}
+			close(released)
+		}(c.readyChannel(p.pane.Name))
+	}
+
+	for _, p := range panes {
+		wg.Add(1)
+		go func(p scheduledPane) {
+			defer wg.Done()
+			if err := c.startScheduled(ctx, cc, p, ready); err != nil {
+				if ctx.Err() == nil {
+					fail(fmt.Errorf("pane %s: %w", p.label, err))
+				}
+			}
+		}(p)
+	}
+
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+	return parent.Err()
+}
+
+// startScheduled runs a single scheduled pane
+func (c *Config) startScheduled(ctx context.Context, cc *command.Chain, p scheduledPane, ready map[string]chan struct{}) error {
+	for _, dep := range p.pane.DependsOn {
+		// Dependencies that are not being started are already running
+		released, ok := ready[dep]
+		if !ok {
+			continue
+		}
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if p.pane.WaitFor != nil {
+		if err := p.pane.WaitFor.wait(ctx, cc, p.waitTarget); err != nil {
+			return err
+		}
+	}
+
+	if err := p.pane.send(ctx, cc, p.id); err != nil {
+		return err
+	}
+
+	if !c.dependedOn(p.pane.Name) {
+		return nil
+	}
+	if p.pane.Ready != nil {
+		if err := p.pane.Ready.wait(ctx, cc, p.readyTarget); err != nil {
+			return fmt.Errorf("not ready: %w", err)
+		}
+	}
+	pc := cc.Clone()
+	pc.Add("tmux", "wait-for", "-S", c.readyChannel(p.pane.Name))
+	return pc.Run(ctx)
+}
+
+// validateDependencies checks pane names and makes sure DependsOn forms a
+// graph without cycles
+func (c *Config) validateDependencies() error {
+	deps := make(map[string][]string)
+	for _, w := range c.Windows {
+		for _, p := range w.Panes {
+			// Unnamed panes can still depend on others, but nothing can depend on them
+			if p.Name == "" {
+				continue
+			}
+			if _, ok := deps[p.Name]; ok {
+				return fmt.Errorf("duplicate pane name %q", p.Name)
+			}
+			deps[p.Name] = p.DependsOn
+		}
+	}
+
+	var names []string
+	for _, w := range c.Windows {
+		for _, p := range w.Panes {
+			for _, dep := range p.DependsOn {
+				if _, ok := deps[dep]; !ok {
+					return fmt.Errorf("pane depends on unknown pane %q", dep)
+				}
+			}
+			if p.Name != "" {
+				names = append(names, p.Name)
+			}
+		}
+	}
+
+	// Depth first search, tracking the current path to report cycles
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+			for i, n := range path {
+				if n == name {
+					start = i
+				}
+			}
+			return fmt.Errorf("dependency cycle: %s -> %s", strings.Join(path[start:], " -> "), name)
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range deps[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
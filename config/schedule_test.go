@@ -0,0 +1,87 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDependencies(t *testing.T) {
+	tests := []struct {
+		name  string
+		panes []*Pane
+		err   string // expected error substring, "" for none
+	}{
+		{
+			name:  "no dependencies",
+			panes: []*Pane{{Name: "db"}, {Name: "api"}, {}},
+		},
+		{
+			name: "chain",
+			panes: []*Pane{
+				{Name: "db"},
+				{Name: "api", DependsOn: []string{"db"}},
+				{Name: "web", DependsOn: []string{"api", "db"}},
+			},
+		},
+		{
+			name: "unnamed pane depends on a named one",
+			panes: []*Pane{
+				{Name: "db"},
+				{DependsOn: []string{"db"}},
+			},
+		},
+		{
+			name:  "duplicate name",
+			panes: []*Pane{{Name: "db"}, {Name: "db"}},
+			err:   `duplicate pane name "db"`,
+		},
+		{
+			name:  "unknown dependency",
+			panes: []*Pane{{Name: "api", DependsOn: []string{"db"}}},
+			err:   `unknown pane "db"`,
+		},
+		{
+			name:  "depends on itself",
+			panes: []*Pane{{Name: "db", DependsOn: []string{"db"}}},
+			err:   "dependency cycle: db -> db",
+		},
+		{
+			name: "cycle",
+			panes: []*Pane{
+				{Name: "a", DependsOn: []string{"b"}},
+				{Name: "b", DependsOn: []string{"c"}},
+				{Name: "c", DependsOn: []string{"a"}},
+			},
+			err: "dependency cycle: a -> b -> c -> a",
+		},
+		{
+			name: "cycle behind a dependency",
+			panes: []*Pane{
+				{Name: "web", DependsOn: []string{"api"}},
+				{Name: "api", DependsOn: []string{"db"}},
+				{Name: "db", DependsOn: []string{"api"}},
+			},
+			err: "dependency cycle: api -> db -> api",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Spread the panes over two windows, dependencies work across them
+			half := len(test.panes) / 2
+			c := &Config{Windows: []*Window{
+				{Name: "one", Panes: test.panes[:half]},
+				{Name: "two", Panes: test.panes[half:]},
+			}}
+			err := c.validateDependencies()
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("unexpected error: %s", err)
+			case test.err != "" && err == nil:
+				t.Fatalf("expected an error containing %q", test.err)
+			case test.err != "" && !strings.Contains(err.Error(), test.err):
+				t.Fatalf("expected an error containing %q, got %q", test.err, err)
+			}
+		})
+	}
+}
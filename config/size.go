@@ -0,0 +1,45 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Size is a pane size, either in lines or columns (e.g. 100) or as a
+// percentage of the window (e.g. "60%"). In a config file it is a number or
+// a string.
+type Size string
+
+// UnmarshalJSON accepts both numbers and strings
+func (s *Size) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		*s = Size(strconv.Itoa(n))
+		return nil
+	}
+	return json.Unmarshal(data, (*string)(s))
+}
+
+// MarshalJSON writes absolute sizes as numbers
+func (s Size) MarshalJSON() ([]byte, error) {
+	if n, err := strconv.Atoi(string(s)); err == nil {
+		return json.Marshal(n)
+	}
+	return json.Marshal(string(s))
+}
+
+// percent reports whether the size is a percentage
+func (s Size) percent() bool {
+	return strings.HasSuffix(string(s), "%")
+}
+
+// validate checks that the size is a positive number or a percentage
+func (s Size) validate() error {
+	n, err := strconv.Atoi(strings.TrimSuffix(string(s), "%"))
+	if err != nil || n <= 0 || s.percent() && n > 100 {
+		return fmt.Errorf("invalid size %q: expected a number or a percentage", string(s))
+	}
+	return nil
+}
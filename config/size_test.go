@@ -0,0 +1,27 @@
+package config
+
+import "testing"
+
+func TestSizeValidate(t *testing.T) {
+	tests := []struct {
+		size Size
+		ok   bool
+	}{
+		{"100", true},
+		{"60%", true},
+		{"100%", true},
+		{"1%", true},
+		{"0", false},
+		{"-5", false},
+		{"0%", false},
+		{"101%", false},
+		{"60 %", false},
+		{"%", false},
+		{"wide", false},
+	}
+	for _, test := range tests {
+		if err := test.size.validate(); (err == nil) != test.ok {
+			t.Errorf("Size(%q).validate() = %v, expected ok = %t", test.size, err, test.ok)
+		}
+	}
+}
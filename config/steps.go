@@ -0,0 +1,151 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/davinche/gmux/command"
+)
+
+// Step is one of the commands a pane runs in sequence. In a config file a
+// step is either just the command or an object with a delay.
+type Step struct {
+	Command string
+
+	// Delay is how long to wait before typing the command, e.g. "2s"
+	Delay string `json:",omitempty"`
+}
+
+// step has the same fields as Step without its JSON methods
+type step Step
+
+// UnmarshalJSON accepts both a plain command string and a step object
+func (s *Step) UnmarshalJSON(data []byte) error {
+	var cmd string
+	if err := json.Unmarshal(data, &cmd); err == nil {
+		*s = Step{Command: cmd}
+		return nil
+	}
+	return json.Unmarshal(data, (*step)(s))
+}
+
+// MarshalJSON writes steps without a delay as a plain string
+func (s *Step) MarshalJSON() ([]byte, error) {
+	if reflect.DeepEqual(*s, Step{Command: s.Command}) {
+		return json.Marshal(s.Command)
+	}
+	return json.Marshal((*step)(s))
+}
+
+// steps returns the commands the pane runs, Command first
+func (p *Pane) steps() []*Step {
+	var steps []*Step
+	if p.Command != "" {
+		steps = append(steps, &Step{Command: p.Command})
+	}
+	return append(steps, p.Commands...)
+}
+
+// CommandLine describes the commands the pane runs on a single line
+func (p *Pane) CommandLine() string {
+	var cmds []string
+	for _, s := range p.steps() {
+		cmds = append(cmds, s.Command)
+	}
+	return strings.Join(cmds, "; ")
+}
+
+// lastCommand returns the command the pane runs last, which is usually the
+// one that keeps running
+func (p *Pane) lastCommand() string {
+	steps := p.steps()
+	if len(steps) == 0 {
+		return ""
+	}
+	return steps[len(steps)-1].Command
+}
+
+// delayed reports whether any of the pane's steps has a delay
+func (p *Pane) delayed() bool {
+	for _, s := range p.Commands {
+		if s.Delay != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSteps checks the pane's steps
+func (p *Pane) validateSteps() error {
+	for idx, s := range p.Commands {
+		if s == nil || s.Command == "" {
+			return fmt.Errorf("Commands: step %d has no command", idx)
+		}
+		if _, err := parseDuration(s.Delay, 0); err != nil {
+			return fmt.Errorf("Commands: step %d: invalid Delay: %s", idx, err)
+		}
+	}
+	return nil
+}
+
+// sendKeys returns the tmux commands typing the given command into the pane.
+// The command is sent literally, so words such as "Enter" or "C-c" in it
+// aren't taken for key names. With enter, the command is also run.
+func sendKeys(paneID, cmd string, enter bool) [][]string {
+	literal := []string{"tmux", "send-keys", "-t", paneID, "-l"}
+	if strings.HasPrefix(cmd, "-") {
+		literal = append(literal, "--")
+	}
+	keys := [][]string{append(literal, cmd)}
+	if enter {
+		keys = append(keys, []string{"tmux", "send-keys", "-t", paneID, "Enter"})
+	}
+	return keys
+}
+
+// keys returns the tmux commands typing the pane's steps and prefill into
+// it, ignoring any delays
+func (p *Pane) keys(paneID string) [][]string {
+	var keys [][]string
+	for _, s := range p.steps() {
+		keys = append(keys, sendKeys(paneID, s.Command, true)...)
+	}
+	if p.Prefill != "" {
+		keys = append(keys, sendKeys(paneID, p.Prefill, false)...)
+	}
+	return keys
+}
+
+// send types the pane's steps and prefill into it, waiting before each step
+// for its delay
+func (p *Pane) send(ctx context.Context, cc *command.Chain, paneID string) error {
+	for _, s := range p.steps() {
+		delay, _ := parseDuration(s.Delay, 0)
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		pc := cc.Clone()
+		for _, keys := range sendKeys(paneID, s.Command, true) {
+			pc.Add(keys...)
+		}
+		if err := pc.Run(ctx); err != nil {
+			return err
+		}
+	}
+	if p.Prefill != "" {
+		pc := cc.Clone()
+		for _, keys := range sendKeys(paneID, p.Prefill, false) {
+			pc.Add(keys...)
+		}
+		return pc.Run(ctx)
+	}
+	return nil
+}
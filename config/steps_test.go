@@ -0,0 +1,37 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSendKeys(t *testing.T) {
+	tests := []struct {
+		cmd   string
+		enter bool
+		want  [][]string
+	}{
+		{"npm start", true, [][]string{
+			{"tmux", "send-keys", "-t", "%1", "-l", "npm start"},
+			{"tmux", "send-keys", "-t", "%1", "Enter"},
+		}},
+		// Key names are typed as text
+		{"echo Enter C-c", true, [][]string{
+			{"tmux", "send-keys", "-t", "%1", "-l", "echo Enter C-c"},
+			{"tmux", "send-keys", "-t", "%1", "Enter"},
+		}},
+		// Commands starting with "-" aren't taken for flags
+		{"-n foo", true, [][]string{
+			{"tmux", "send-keys", "-t", "%1", "-l", "--", "-n foo"},
+			{"tmux", "send-keys", "-t", "%1", "Enter"},
+		}},
+		{`git commit -m "wip; it's done"`, false, [][]string{
+			{"tmux", "send-keys", "-t", "%1", "-l", `git commit -m "wip; it's done"`},
+		}},
+	}
+	for _, test := range tests {
+		if got := sendKeys("%1", test.cmd, test.enter); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("sendKeys(%q, %t) = %q, expected %q", test.cmd, test.enter, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davinche/gmux/command"
+)
+
+// Defaults for WaitFor when no Timeout or Interval is given
+const (
+	defaultWaitTimeout  = 30 * time.Second
+	defaultWaitInterval = 500 * time.Millisecond
+)
+
+// WaitFor describes conditions that must all hold before a pane's command is
+// sent to it. gmux polls the conditions until they hold or the timeout expires.
+type WaitFor struct {
+	TCP      string `json:",omitempty"` // host:port that must accept connections
+	File     string `json:",omitempty"` // path that must exist
+	Socket   string `json:",omitempty"` // path to a unix socket that must exist
+	Pane     string `json:",omitempty"` // pane whose output must match Output ("window" or "window.pane")
+	Output   string `json:",omitempty"` // regular expression matched against the pane's contents
+	Timeout  string `json:",omitempty"` // how long to wait in total, e.g. "1m" (default 30s)
+	Interval string `json:",omitempty"` // how long to wait between checks (default 500ms)
+}
+
+// validate checks that the conditions can be evaluated
+func (w *WaitFor) validate(c *Config) error {
+	if w.TCP == "" && w.File == "" && w.Socket == "" && w.Pane == "" {
+		return fmt.Errorf("no condition given")
+	}
+	if w.TCP != "" {
+		if _, _, err := net.SplitHostPort(w.TCP); err != nil {
+			return fmt.Errorf("invalid TCP address: %s", err)
+		}
+	}
+	if (w.Pane == "") != (w.Output == "") {
+		return fmt.Errorf("Pane and Output must be given together")
+	}
+	if w.Pane != "" {
+		if _, _, err := c.findPane(w.Pane); err != nil {
+			return err
+		}
+		if _, err := regexp.Compile("(?m)" + w.Output); err != nil {
+			return fmt.Errorf("invalid Output: %s", err)
+		}
+	}
+	if _, err := parseDuration(w.Timeout, defaultWaitTimeout); err != nil {
+		return fmt.Errorf("invalid Timeout: %s", err)
+	}
+	if _, err := parseDuration(w.Interval, defaultWaitInterval); err != nil {
+		return fmt.Errorf("invalid Interval: %s", err)
+	}
+	return nil
+}
+
+// wait polls the conditions until all of them hold. target is the tmux ID of
+// the pane referenced by w.Pane, if any.
+func (w *WaitFor) wait(ctx context.Context, cc *command.Chain, target string) error {
+	timeout, _ := parseDuration(w.Timeout, defaultWaitTimeout)
+	interval, _ := parseDuration(w.Interval, defaultWaitInterval)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Let ^ and $ match at line boundaries of the captured pane
+	var output *regexp.Regexp
+	if w.Output != "" {
+		output = regexp.MustCompile("(?m)" + w.Output)
+	}
+
+	var last string
+	for {
+		pending, err := w.check(ctx, cc, target, output)
+		if err != nil {
+			return err
+		}
+		if pending == "" {
+			return nil
+		}
+		if cc.Debug && pending != last {
+			log.Printf("debug: waiting for %s", pending)
+		}
+		last = pending
+
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return fmt.Errorf("timed out after %s waiting for %s", timeout, pending)
+			}
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// check evaluates each condition once and describes the first one that does
+// not hold yet. An empty description means all conditions hold.
+func (w *WaitFor) check(ctx context.Context, cc *command.Chain, target string, output *regexp.Regexp) (string, error) {
+	if w.File != "" {
+		if _, err := os.Stat(expandPath(w.File)); err != nil {
+			return fmt.Sprintf("file %s", w.File), nil
+		}
+	}
+	if w.Socket != "" {
+		fInfo, err := os.Stat(expandPath(w.Socket))
+		if err != nil || fInfo.Mode()&os.ModeSocket == 0 {
+			return fmt.Sprintf("socket %s", w.Socket), nil
+		}
+	}
+	if w.TCP != "" {
+		conn, err := net.DialTimeout("tcp", w.TCP, time.Second)
+		if err != nil {
+			return fmt.Sprintf("tcp %s", w.TCP), nil
+		}
+		conn.Close()
+	}
+	if w.Pane != "" {
+		out, err := cc.Output(ctx, "tmux", "capture-pane", "-p", "-J", "-t", target)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Sprintf("output of pane %s", w.Pane), nil
+			}
+			return "", err
+		}
+		if !output.MatchString(out) {
+			return fmt.Sprintf("output of pane %s to match %q", w.Pane, w.Output), nil
+		}
+	}
+	return "", nil
+}
+
+// findPane resolves a pane reference, either a pane's Name or the form
+// "window" or "window.pane", into the indexes of the window and pane in the config
+func (c *Config) findPane(ref string) (int, int, error) {
+	for wIdx, w := range c.Windows {
+		for pIdx, p := range w.Panes {
+			if p != nil && p.Name != "" && p.Name == ref {
+				return wIdx, pIdx, nil
+			}
+		}
+	}
+
+	winName, paneIdx := ref, 0
+	if i := strings.LastIndex(ref, "."); i != -1 {
+		if n, err := strconv.Atoi(ref[i+1:]); err == nil {
+			winName, paneIdx = ref[:i], n
+		}
+	}
+	for wIdx, w := range c.Windows {
+		if w.Name != winName {
+			continue
+		}
+		if paneIdx < 0 || paneIdx >= w.paneCount() {
+			return 0, 0, fmt.Errorf("window %q has no pane %d", winName, paneIdx)
+		}
+		return wIdx, paneIdx, nil
+	}
+	return 0, 0, fmt.Errorf("no window named %q", winName)
+}
+
+// parseDuration parses an optional duration, falling back to def when empty
+func parseDuration(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"time"
 
 	gmux "github.com/davinche/gmux/cli"
 	"github.com/urfave/cli"
@@ -21,8 +22,29 @@ func main() {
 			Name:  "debug, d",
 			Usage: "enable debug logging",
 		},
+		cli.StringFlag{
+			Name:  "socket-name, L",
+			Usage: "use the tmux server with this socket name (see tmux -L)",
+		},
+		cli.StringFlag{
+			Name:  "socket-path, S",
+			Usage: "use the tmux server with this socket path (see tmux -S)",
+		},
+		cli.DurationFlag{
+			Name:   "timeout",
+			Usage:  "total time allowed for starting a session (0 for no limit)",
+			EnvVar: "GMUX_TIMEOUT",
+		},
+		cli.DurationFlag{
+			Name:   "command-timeout",
+			Usage:  "time allowed for each tmux command (0 for no limit)",
+			EnvVar: "GMUX_COMMAND_TIMEOUT",
+			Value:  10 * time.Second,
+		},
 	}
 
+	app.Before = gmux.Before
+
 	app.Commands = []cli.Command{
 		{
 			Name:      "new",
@@ -48,9 +70,64 @@ func main() {
 		{
 			Name:         "start",
 			Usage:        "start a tmux session using a gmux config",
+			Description:  "Starting several configs, or a group config, creates every session detached and then attaches to the primary one.",
 			Action:       gmux.Start,
+			ArgsUsage:    "config_name [config_name...]",
+			BashComplete: gmux.BashCompleteList,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "name, n",
+					Usage: "session name to use instead of the config's Name, to run a config more than once",
+				},
+				cli.StringFlag{
+					Name:  "if-exists",
+					Usage: "what to do when the session already exists: attach, recreate, reconcile or fail (default: the config's IfExists, else attach)",
+				},
+				cli.BoolFlag{
+					Name:  "prune",
+					Usage: "when reconciling, remove windows and panes that are not in the config",
+				},
+				cli.StringFlag{
+					Name:  "primary",
+					Usage: "config whose session to attach to when starting several configs",
+				},
+			},
+		},
+		{
+			Name:         "apply",
+			Usage:        "make a running tmux session match its gmux config",
+			Description:  "Creates the windows and panes that are missing from the session without touching the panes already running. The session is started if it is not running.",
 			ArgsUsage:    "config_name",
+			Action:       gmux.Apply,
 			BashComplete: gmux.BashCompleteList,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "name, n",
+					Usage: "session name to use instead of the config's Name",
+				},
+				cli.BoolFlag{
+					Name:  "prune",
+					Usage: "remove windows and panes that are not in the config",
+				},
+			},
+		},
+		{
+			Name:         "diff",
+			Usage:        "show how a running tmux session differs from its gmux config",
+			Description:  "Compares the session's windows, panes, layouts, pane directories and running commands with the config. Layouts can only be compared for custom layout strings.",
+			ArgsUsage:    "config_name",
+			Action:       gmux.Diff,
+			BashComplete: gmux.BashCompleteList,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "name, n",
+					Usage: "session name to use instead of the config's Name",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the diff as JSON",
+				},
+			},
 		},
 		{
 			Name:         "stop",
@@ -60,21 +137,75 @@ func main() {
 			Action:       gmux.Stop,
 			BashComplete: gmux.BashCompleteList,
 		},
+		{
+			Name:         "logs",
+			Usage:        "print or follow the log of a pane",
+			Description:  "Prints the output logged for a pane of a config's session, given by the pane's name or as window or window.pane. Only panes (or windows) with Log enabled are logged.",
+			ArgsUsage:    "config_name pane",
+			Action:       gmux.Logs,
+			BashComplete: gmux.BashCompleteList,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "name, n",
+					Usage: "session name to use instead of the config's Name",
+				},
+				cli.BoolFlag{
+					Name:  "follow, f",
+					Usage: "keep printing output as it is logged",
+				},
+			},
+		},
+		{
+			Name:      "log-pipe",
+			Usage:     "write a pane's output to its log file (used by tmux)",
+			ArgsUsage: "file",
+			Action:    gmux.LogPipe,
+			Hidden:    true,
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "max-size",
+					Usage: "size in bytes at which the log is rotated",
+				},
+			},
+		},
+		{
+			Name:    "ps",
+			Aliases: []string{"status"},
+			Usage:   "lists running tmux sessions and the gmux configs they were started from",
+			Action:  gmux.Ps,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the sessions as JSON",
+				},
+			},
+		},
 		{
 			Name:    "list",
 			Aliases: []string{"ls"},
 			Usage:   "lists all available gmux configs",
 			Action:  gmux.List,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "quiet, q",
+					Usage: "only print config names",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the configs as JSON",
+				},
+			},
 		},
 	}
 
-	// Default action to show the help menu
+	// Default action to start the given config, or to pick one interactively
+	// (falling back to the help menu when not running in a terminal)
 	app.Action = func(c *cli.Context) error {
 		configName := c.Args().First()
 		if configName != "" {
 			return gmux.Start(c)
 		}
-		return gmux.ShowHelp(c)
+		return gmux.Pick(c)
 	}
 	app.Run(os.Args)
 }